@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+const (
+	// agentSocketEnv is an environment variable with the agent socket path
+	// used by clients
+	agentSocketEnv = "EC2AUTH_AGENT_SOCK"
+	// agentTimeout limits a token request to the agent, so a stuck agent
+	// doesn't block clients
+	agentTimeout = 2 * time.Second
+)
+
+// runAgent runs a daemon, which keeps a fresh token and serves it over a Unix
+// socket and optionally writes it to a file
+func runAgent(args []string) {
+	var conn connOptions
+	var cred credOptions
+	var agent pkg.Agent
+	var socket string
+	var file string
+	var format string
+	var tmpl string
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	conn.addFlags(fs)
+	cred.addFlags(fs)
+	fs.StringVar(&socket, "socket", "", "Unix socket to serve the token on (default "+agentSocketEnv+" environment variable)")
+	fs.StringVar(&file, "file", "", "file to atomically write the token to on each refresh")
+	fs.StringVar(&format, "format", formatToken, "--file format: "+strings.Join(outputFormats, ", "))
+	fs.StringVar(&tmpl, "template", "", "Go text/template to render the --file, when --format is template")
+	fs.DurationVar(&agent.Margin, "refresh-margin", pkg.DefaultAgentMargin, "refresh the token this duration before it expires")
+	fs.DurationVar(&agent.Jitter, "refresh-jitter", pkg.DefaultAgentJitter, "maximum random duration subtracted from the refresh time")
+	fs.DurationVar(&agent.MaxRetry, "refresh-max-backoff", pkg.DefaultAgentMaxRetry, "maximum delay between failed refresh attempts")
+	fs.Parse(args)
+
+	if socket == "" {
+		socket = os.Getenv(agentSocketEnv)
+	}
+
+	errors := append(conn.validate(), cred.validate(&conn)...)
+
+	if socket == "" && file == "" {
+		errors = append(errors, fmt.Errorf("Please define --socket parameter, %s environment variable or --file parameter", agentSocketEnv))
+	}
+
+	if agent.Margin < 0 || agent.Jitter < 0 || agent.MaxRetry < 0 {
+		errors = append(errors, fmt.Errorf("refresh options must not be negative"))
+	}
+
+	printer, err := newOutputPrinter(format, tmpl, conn.authURL)
+	if err != nil {
+		errors = append(errors, err)
+	}
+
+	exitOnErrors(errors)
+
+	identityClient, err := conn.newIdentityClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the secret is kept in memory to refresh the token
+	ao := &cred.ao
+	agent.AuthURL = identityClient.IdentityEndpoint
+	agent.Access = ao.Access
+	agent.Auth = func(ctx context.Context) (*pkg.AuthResult, error) {
+		if conn.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, conn.timeout)
+			defer cancel()
+		}
+		return pkg.OpenStackEC2AuthWithContext(ctx, identityClient, ao)
+	}
+	agent.OnRefresh = func(res *pkg.AuthResult, next time.Duration) {
+		log.Printf("Token refreshed, expires at %s, next refresh in %s", res.ExpiresAt, next.Round(time.Second))
+		if file == "" {
+			return
+		}
+		var buf bytes.Buffer
+		if err := printer.Print(&buf, res); err != nil {
+			log.Printf("failed to render the token: %v", err)
+			return
+		}
+		if err := pkg.WriteFileAtomic(file, buf.Bytes(), 0600); err != nil {
+			log.Printf("failed to write the token: %v", err)
+		}
+	}
+	agent.OnError = func(err error, next time.Duration) {
+		log.Printf("Failed to refresh the token, retrying in %s: %v", next.Round(time.Millisecond), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	var srv *http.Server
+	if socket != "" {
+		l, err := pkg.ListenUnix(socket)
+		if err != nil {
+			log.Fatal(err)
+		}
+		srv = &http.Server{Handler: &agent}
+		go func() {
+			if err := srv.Serve(l); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+		log.Printf("Serving the token on %s", socket)
+	}
+
+	err = agent.Run(ctx)
+
+	if srv != nil {
+		// closing the listener removes the socket file
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}
+
+	if err != context.Canceled {
+		exitWithError(fmt.Errorf("Credential is rejected, stopping the agent: %w", err))
+	}
+}
+
+// agentToken fetches a token from the agent, nil is returned, when the agent
+// is not available or its token doesn't match the requested auth URL, EC2
+// access or clouds.yaml project
+func agentToken(ctx context.Context, socket, authURL, access string, cloud *pkg.Cloud, logger pkg.ILogger) *pkg.AuthResult {
+	ctx, cancel := context.WithTimeout(ctx, agentTimeout)
+	defer cancel()
+
+	logger.RequestPrintf("Fetching the token from the agent on %s", socket)
+	res, err := pkg.GetAgentToken(ctx, socket)
+	if err == nil {
+		var projectID, projectName string
+		if cloud != nil {
+			projectID, projectName = cloud.ProjectID, cloud.ProjectName
+		}
+		err = res.Check(authURL, access, projectID, projectName)
+	}
+	if err != nil {
+		logger.ResponsePrintf("Falling back to the direct authentication: %v", err)
+		return nil
+	}
+	return &res.AuthResult
+}
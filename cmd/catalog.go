@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+// runCatalog authenticates and lists the service catalog or prints a single
+// endpoint URL
+func runCatalog(args []string) {
+	var conn connOptions
+	var cred credOptions
+	var cache cacheOptions
+	var opts gophercloud.EndpointOpts
+	var availability string
+	var format string
+	fs := flag.NewFlagSet("catalog", flag.ExitOnError)
+	conn.addFlags(fs)
+	cred.addFlags(fs)
+	cache.addFlags(fs)
+	fs.StringVar(&opts.Type, "service-type", "", "print a single endpoint URL of the service type, e.g. object-store")
+	fs.StringVar(&opts.Name, "service-name", "", "filter endpoints by the service name")
+	fs.StringVar(&availability, "interface", "", "filter endpoints by the interface: public, internal or admin (default public with --service-type)")
+	fs.StringVar(&opts.Region, "endpoint-region", "", "filter endpoints by the region (default region_name in clouds.yaml or OS_REGION_NAME environment variable)")
+	fs.StringVar(&format, "format", "text", "catalog list output format: text or json")
+	fs.Parse(args)
+
+	errors := append(conn.validate(), cred.validate(&conn)...)
+
+	switch gophercloud.Availability(availability) {
+	case "", gophercloud.AvailabilityPublic, gophercloud.AvailabilityInternal, gophercloud.AvailabilityAdmin:
+		opts.Availability = gophercloud.Availability(availability)
+	default:
+		errors = append(errors, fmt.Errorf("unsupported interface %q, supported interfaces: public, internal, admin", availability))
+	}
+
+	if format != "text" && format != "json" {
+		errors = append(errors, fmt.Errorf("unsupported output format %q, supported formats: text, json", format))
+	}
+
+	exitOnErrors(errors)
+
+	if opts.Region == "" {
+		opts.Region = conn.regionName
+	}
+
+	identityClient, err := conn.newIdentityClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := conn.context()
+	defer cancel()
+
+	res, err := cache.authenticate(ctx, identityClient, &cred.ao, conn.logger())
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if opts.Type != "" {
+		url, err := res.EndpointURL(opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(url)
+		return
+	}
+
+	catalog := filterCatalog(res.Catalog, opts)
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(catalog); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tNAME\tINTERFACE\tREGION\tURL")
+	for _, e := range catalog {
+		for _, v := range e.Endpoints {
+			region := v.Region
+			if region == "" {
+				region = v.RegionID
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Type, e.Name, v.Interface, region, v.URL)
+		}
+	}
+	w.Flush()
+}
+
+// filterCatalog returns catalog entries and endpoints, which match the
+// service name, interface and region filters
+func filterCatalog(catalog []tokens.CatalogEntry, opts gophercloud.EndpointOpts) []tokens.CatalogEntry {
+	result := []tokens.CatalogEntry{}
+	for _, e := range catalog {
+		if opts.Name != "" && e.Name != opts.Name {
+			continue
+		}
+		var endpoints []tokens.Endpoint
+		for _, v := range e.Endpoints {
+			if opts.Availability != "" && v.Interface != string(opts.Availability) {
+				continue
+			}
+			if opts.Region != "" && v.Region != opts.Region && v.RegionID != opts.Region {
+				continue
+			}
+			endpoints = append(endpoints, v)
+		}
+		if len(endpoints) > 0 {
+			e.Endpoints = endpoints
+			result = append(result, e)
+		}
+	}
+	return result
+}
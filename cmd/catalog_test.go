@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+func TestFilterCatalog(t *testing.T) {
+	catalog := []tokens.CatalogEntry{
+		{
+			Type: "object-store",
+			Name: "swift",
+			Endpoints: []tokens.Endpoint{
+				{ID: "s1", Interface: "public", Region: "RegionOne", RegionID: "RegionOne"},
+				{ID: "s2", Interface: "internal", Region: "RegionOne", RegionID: "RegionOne"},
+				// newer Keystone versions may omit the region name
+				{ID: "s3", Interface: "public", RegionID: "region-two"},
+			},
+		},
+		{
+			Type: "compute",
+			Name: "nova",
+			Endpoints: []tokens.Endpoint{
+				{ID: "n1", Interface: "admin", Region: "RegionOne"},
+				{ID: "n2", Interface: "public", Region: "region-two"},
+			},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		opts     gophercloud.EndpointOpts
+		expected []string
+	}{
+		{"no filters", gophercloud.EndpointOpts{}, []string{"s1", "s2", "s3", "n1", "n2"}},
+		{"service name", gophercloud.EndpointOpts{Name: "nova"}, []string{"n1", "n2"}},
+		{"interface", gophercloud.EndpointOpts{Availability: gophercloud.AvailabilityPublic}, []string{"s1", "s3", "n2"}},
+		{"region", gophercloud.EndpointOpts{Region: "RegionOne"}, []string{"s1", "s2", "n1"}},
+		// a region ID and a region name match the same filter
+		{"region id", gophercloud.EndpointOpts{Region: "region-two"}, []string{"s3", "n2"}},
+		{"all filters", gophercloud.EndpointOpts{Name: "swift", Availability: gophercloud.AvailabilityPublic, Region: "region-two"}, []string{"s3"}},
+		{"invalid interface", gophercloud.EndpointOpts{Availability: "private"}, nil},
+		{"no match", gophercloud.EndpointOpts{Name: "cinder"}, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result := filterCatalog(catalog, c.opts)
+			if result == nil {
+				t.Fatalf("expected an empty catalog instead of nil")
+			}
+
+			var ids []string
+			for _, e := range result {
+				if len(e.Endpoints) == 0 {
+					t.Errorf("%s service without endpoints is listed", e.Name)
+				}
+				for _, v := range e.Endpoints {
+					ids = append(ids, v.ID)
+				}
+			}
+			if len(ids) != len(c.expected) {
+				t.Fatalf("expected %v endpoints, got %v", c.expected, ids)
+			}
+			for i := range ids {
+				if ids[i] != c.expected[i] {
+					t.Fatalf("expected %v endpoints, got %v", c.expected, ids)
+				}
+			}
+		})
+	}
+
+	// the source catalog is not modified
+	if len(catalog[0].Endpoints) != 3 || len(catalog[1].Endpoints) != 2 {
+		t.Errorf("source catalog is modified: %+v", catalog)
+	}
+}
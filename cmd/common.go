@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+// defaultResponseTimeout is a default Keystone response headers timeout, when
+// --timeout is not set
+const defaultResponseTimeout = 9 * time.Second
+
+// connOptions represents CLI options used to connect to Keystone
+type connOptions struct {
+	authURL     string
+	host        string
+	insecureTLS bool
+	cacert      string
+	debug       bool
+	// clouds.yaml settings
+	cloudName  string
+	cloud      *pkg.Cloud
+	regionName string
+	// timeouts
+	timeout         time.Duration
+	connectTimeout  time.Duration
+	tlsTimeout      time.Duration
+	responseTimeout time.Duration
+	// retry policy
+	retries         int
+	retryBackoff    time.Duration
+	retryMaxBackoff time.Duration
+	retryBudget     time.Duration
+	// conns counts connections, when not nil
+	conns *connCounter
+}
+
+func (o *connOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.authURL, "auth-url", "", "Keystone auth URL")
+	fs.StringVar(&o.host, "host", "", "override keystone HOST")
+	fs.BoolVar(&o.insecureTLS, "insecure-tls", false, "Whether to ignore server TLS certificate verification")
+	fs.StringVar(&o.cacert, "cacert", "", "CA certificate bundle file to verify the Keystone TLS certificate (default OS_CACERT environment variable)")
+	fs.StringVar(&o.cloudName, "os-cloud", "", "cloud name in clouds.yaml (default OS_CLOUD environment variable)")
+	fs.BoolVar(&o.debug, "debug", false, "show debug logs")
+	fs.DurationVar(&o.timeout, "timeout", 0, "overall timeout of a single authentication including retries, 0 means no timeout")
+	fs.DurationVar(&o.connectTimeout, "connect-timeout", 5*time.Second, "Keystone connection timeout")
+	fs.DurationVar(&o.tlsTimeout, "tls-timeout", 9*time.Second, "Keystone TLS handshake timeout")
+	fs.DurationVar(&o.responseTimeout, "response-timeout", 0, "Keystone response headers timeout of a single attempt (default --timeout or "+defaultResponseTimeout.String()+")")
+	fs.IntVar(&o.retries, "retries", 0, "how many times to retry connection errors, 5xx and 429 responses")
+	fs.DurationVar(&o.retryBackoff, "retry-backoff", pkg.DefaultRetryBackoff, "base exponential backoff delay between retries")
+	fs.DurationVar(&o.retryMaxBackoff, "retry-max-backoff", pkg.DefaultMaxRetryBackoff, "maximum delay between retries, also caps Retry-After")
+	fs.DurationVar(&o.retryBudget, "retry-budget", 0, "maximum overall time spent on retries, 0 means unlimited")
+}
+
+// loadCloud returns the --os-cloud settings, nil is returned, when a cloud is
+// not selected
+func (o *connOptions) loadCloud() (*pkg.Cloud, error) {
+	if o.cloudName == "" {
+		o.cloudName = os.Getenv("OS_CLOUD")
+	}
+	if o.cloudName == "" || o.cloud != nil {
+		return o.cloud, nil
+	}
+
+	var err error
+	o.cloud, err = pkg.LoadCloud(o.cloudName)
+	return o.cloud, err
+}
+
+func (o *connOptions) validate() []error {
+	// clouds.yaml settings take precedence over environment variables
+	cloud, err := o.loadCloud()
+	if err != nil {
+		return []error{err}
+	}
+	if cloud != nil {
+		if o.authURL == "" {
+			o.authURL = cloud.AuthURL
+		}
+		if o.cacert == "" {
+			o.cacert = cloud.CACert
+		}
+		if cloud.Verify != nil && !*cloud.Verify {
+			o.insecureTLS = true
+		}
+		o.regionName = cloud.RegionName
+	}
+
+	if o.authURL == "" {
+		o.authURL = os.Getenv("OS_AUTH_URL")
+	}
+
+	if o.cacert == "" {
+		o.cacert = os.Getenv("OS_CACERT")
+	}
+
+	if o.regionName == "" {
+		o.regionName = os.Getenv("OS_REGION_NAME")
+	}
+
+	if o.authURL == "" {
+		return []error{fmt.Errorf("Please define --auth-url parameter, OS_AUTH_URL environment variable or auth_url in clouds.yaml")}
+	}
+
+	if o.timeout < 0 || o.connectTimeout < 0 || o.tlsTimeout < 0 || o.responseTimeout < 0 {
+		return []error{fmt.Errorf("timeout options must not be negative")}
+	}
+
+	if o.retries < 0 || o.retryBackoff < 0 || o.retryMaxBackoff < 0 || o.retryBudget < 0 {
+		return []error{fmt.Errorf("retry options must not be negative")}
+	}
+
+	return nil
+}
+
+func (o *connOptions) logger() pkg.ILogger {
+	if o.debug {
+		return &pkg.Logger{}
+	}
+	return &pkg.NoopLogger{}
+}
+
+// context returns a context, which is canceled after the --timeout
+func (o *connOptions) context() (context.Context, context.CancelFunc) {
+	return withTimeout(o.timeout)
+}
+
+// withTimeout returns a context with a timeout, zero means no timeout
+func withTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// newIdentityClient returns a Keystone V3 client, which uses pkg.RoundTripper
+func (o *connOptions) newIdentityClient() (*gophercloud.ServiceClient, error) {
+	provider, err := openstack.NewClient(o.authURL)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: o.insecureTLS,
+	}
+	if o.cacert != "" {
+		pem, err := ioutil.ReadFile(o.cacert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA certificate: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %q", o.cacert)
+		}
+	}
+	// a slow response must not fail before the overall --timeout
+	responseTimeout := o.responseTimeout
+	if responseTimeout == 0 {
+		responseTimeout = defaultResponseTimeout
+		if o.timeout > 0 {
+			responseTimeout = o.timeout
+		}
+	}
+	dial := (&net.Dialer{
+		Timeout:   o.connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).Dial
+	if o.conns != nil {
+		dial = o.conns.wrap(dial)
+	}
+	provider.HTTPClient = http.Client{
+		Transport: &pkg.RoundTripper{
+			Rt: &http.Transport{
+				TLSClientConfig:       tlsConfig,
+				Dial:                  dial,
+				TLSHandshakeTimeout:   o.tlsTimeout,
+				ResponseHeaderTimeout: responseTimeout,
+				ExpectContinueTimeout: 1 * time.Second,
+			},
+			Host:            &o.host,
+			Logger:          o.logger(),
+			MaxRetries:      o.retries,
+			RetryBackoff:    o.retryBackoff,
+			MaxRetryBackoff: o.retryMaxBackoff,
+			RetryBudget:     o.retryBudget,
+		},
+	}
+
+	return openstack.NewIdentityV3(provider, gophercloud.EndpointOpts{})
+}
+
+// credOptions represents CLI options used to calculate an EC2 signature
+type credOptions struct {
+	ao      ec2tokens.AuthOptions
+	sigOpts signatureOptions
+	// AWS profile and secret sources
+	profile      string
+	secretFile   string
+	secretFD     int
+	secretPrompt bool
+	// optional is true, when credentials are provided in another way
+	optional bool
+}
+
+func (o *credOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.ao.Access, "access", "", "EC2 access")
+	fs.StringVar(&o.ao.Secret, "secret", "", "EC2 secret")
+	fs.StringVar(&o.secretFile, "secret-file", "", "file to read the EC2 secret from, \"-\" means stdin, the file must not be accessible by other users")
+	fs.IntVar(&o.secretFD, "secret-fd", -1, "inherited file descriptor to read the EC2 secret from")
+	fs.BoolVar(&o.secretPrompt, "secret-prompt", false, "prompt for the EC2 secret without echo")
+	fs.StringVar(&o.profile, "profile", "", "AWS profile to read EC2 credentials from (default AWS_PROFILE environment variable or \"default\")")
+	fs.StringVar(&o.sigOpts.version, "signature-version", "4", "EC2 signature version: 2 or 4")
+	fs.StringVar(&o.sigOpts.method, "signature-method", "", "EC2 signature method: "+ec2tokens.EC2CredentialsHmacSha1V2+" or "+ec2tokens.EC2CredentialsHmacSha256V2+" (default) for V2, "+ec2tokens.EC2CredentialsAwsHmacV4+" for V4")
+	fs.StringVar(&o.sigOpts.requestFile, "request-file", "", "JSON file with a signed request description")
+	fs.StringVar(&o.sigOpts.request.Region, "region", "", "region name used to calculate a signature V4")
+	fs.StringVar(&o.sigOpts.request.Service, "service", "", "service name used to calculate a signature V4")
+	fs.StringVar(&o.sigOpts.request.Verb, "verb", "", "signed request HTTP method")
+	fs.StringVar(&o.sigOpts.request.Path, "path", "", "signed request path")
+	fs.StringVar(&o.sigOpts.request.Host, "request-host", "", "signed request Host")
+	fs.Var(&o.sigOpts.request.Params, "param", "signed request query parameter in a key=value format, can be repeated")
+	fs.Var(&o.sigOpts.request.Headers, "header", "signed request header in a key=value format, can be repeated")
+	fs.StringVar(&o.sigOpts.request.SignedHeaders, "signed-headers", "", "semicolon separated list of signed headers (default all --header names)")
+	fs.StringVar(&o.sigOpts.request.BodyHash, "body-hash", "", "signed request body sha256 hex digest (default random, an empty body digest for the sign command)")
+	fs.StringVar(&o.sigOpts.request.BodyFile, "body-file", "", "file to calculate the signed request body hash from, \"-\" means stdin")
+}
+
+// validate resolves EC2 credentials using the --access flag, the --os-cloud
+// settings or the default credential provider chain, the credentials source
+// is reported to the connection logger
+func (o *credOptions) validate(conn *connOptions) []error {
+	var errors []error
+
+	// a secret passed explicitly overrides the resolved one
+	secret, secretErr := o.readSecret()
+	if secretErr != nil {
+		errors = append(errors, secretErr)
+	}
+
+	providers := credentialProviders(o.profile, conn)
+	if o.ao.Access != "" {
+		providers = []pkg.CredentialProvider{
+			&pkg.StaticProvider{Credentials: pkg.Credentials{
+				Access: o.ao.Access,
+				// backward compatibility
+				Secret: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+				Source: "--access parameter",
+			}},
+		}
+	}
+
+	c, err := (&pkg.ChainProvider{Providers: providers, Logger: conn.logger()}).Retrieve()
+	if err != nil {
+		errors = append(errors, err)
+	}
+	if c != nil {
+		o.ao.Access = c.Access
+		o.ao.Secret = c.Secret
+	}
+	if secret != "" {
+		o.ao.Secret = secret
+	}
+
+	if o.ao.Access == "" && err == nil && !o.optional {
+		errors = append(errors, fmt.Errorf("Please define --access parameter, AWS_ACCESS_KEY_ID or EC2_ACCESS_KEY environment variable or an AWS profile"))
+	}
+
+	// secret is not required, when the signature is already calculated
+	if o.ao.Access != "" && o.ao.Secret == "" && o.ao.Signature == nil && secretErr == nil && !o.optional {
+		errors = append(errors, fmt.Errorf("Please define --secret, --secret-file, --secret-fd or --secret-prompt parameter, AWS_SECRET_ACCESS_KEY or EC2_SECRET_KEY environment variable or an AWS profile"))
+	}
+
+	// the secret must never appear in logs and errors
+	logRedactor.add(o.ao.Secret)
+
+	if err := o.sigOpts.apply(&o.ao); err != nil {
+		errors = append(errors, err)
+	}
+
+	return errors
+}
+
+// credentialProviders returns a provider chain, which resolves EC2
+// credentials using the --os-cloud settings and the default providers. An
+// explicit profile is the only source, the cloud is used for the connection
+// settings only.
+func credentialProviders(profile string, conn *connOptions) []pkg.CredentialProvider {
+	providers := pkg.DefaultProviders(profile)
+	if profile != "" {
+		return providers
+	}
+	// errors are reported by the connection options
+	if cloud, _ := conn.loadCloud(); cloud != nil {
+		providers = append([]pkg.CredentialProvider{&pkg.CloudProvider{Cloud: cloud}}, providers...)
+	}
+	return providers
+}
+
+// readSecret returns the secret passed using one of the secret parameters
+func (o *credOptions) readSecret() (string, error) {
+	var n int
+	for _, v := range []bool{o.ao.Secret != "", o.secretFile != "", o.secretFD >= 0, o.secretPrompt} {
+		if v {
+			n++
+		}
+	}
+	if n > 1 {
+		return "", fmt.Errorf("--secret, --secret-file, --secret-fd and --secret-prompt parameters are mutually exclusive")
+	}
+
+	var secret string
+	var err error
+	switch {
+	case o.ao.Secret != "":
+		log.Printf("WARNING: the --secret parameter is visible in the process list and the shell history, use --secret-file, --secret-fd or --secret-prompt instead")
+		return o.ao.Secret, nil
+	case o.secretFile != "":
+		secret, err = pkg.ReadSecret(o.secretFile)
+	case o.secretFD >= 0:
+		secret, err = pkg.ReadSecretFD(uintptr(o.secretFD))
+	case o.secretPrompt:
+		secret, err = pkg.PromptSecret("EC2 secret: ")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the secret: %v", err)
+	}
+
+	return secret, nil
+}
+
+// exitOnErrors prints errors and exits, when the list is not empty
+func exitOnErrors(errors []error) {
+	if errors != nil {
+		for _, e := range errors {
+			log.Printf("%s", e)
+		}
+		os.Exit(1)
+	}
+}
+
+// cacheOptions represents CLI options used to cache tokens on disk
+type cacheOptions struct {
+	enabled bool
+	dir     string
+	margin  time.Duration
+}
+
+func (o *cacheOptions) addFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.enabled, "cache", false, "Whether to cache the token on disk and reuse it until it expires")
+	fs.StringVar(&o.dir, "cache-dir", "", "token cache directory (default $XDG_CACHE_HOME/ec2auth)")
+	fs.DurationVar(&o.margin, "cache-margin", pkg.DefaultCacheMargin, "don't reuse a cached token, when it expires within this duration")
+}
+
+// authenticate returns a cached token, when the cache is enabled, otherwise
+// it authenticates using EC2 credentials
+func (o *cacheOptions) authenticate(ctx context.Context, identityClient *gophercloud.ServiceClient, ao *ec2tokens.AuthOptions, logger pkg.ILogger) (*pkg.AuthResult, error) {
+	if !o.enabled {
+		return pkg.OpenStackEC2AuthWithContext(ctx, identityClient, ao)
+	}
+
+	cache, err := pkg.NewTokenCache(o.dir, o.margin)
+	if err != nil {
+		return nil, err
+	}
+	cache.Logger = logger
+
+	return pkg.OpenStackEC2AuthCachedWithContext(ctx, identityClient, ao, cache)
+}
+
+// tokenOptions represents CLI options used to select an existing token
+type tokenOptions struct {
+	token    string
+	access   string
+	profile  string
+	cacheDir string
+}
+
+func (o *tokenOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.token, "token", "", "Keystone token, default OS_TOKEN environment variable or a token cached for --access")
+	fs.StringVar(&o.access, "access", "", "EC2 access used to look up a cached token (default resolved the same way as EC2 credentials)")
+	fs.StringVar(&o.profile, "profile", "", "AWS profile to read the EC2 access from (default AWS_PROFILE environment variable or \"default\")")
+	fs.StringVar(&o.cacheDir, "cache-dir", "", "token cache directory (default $XDG_CACHE_HOME/ec2auth)")
+}
+
+// validate resolves the token or the EC2 access, which is used to look up a
+// cached token, the access is resolved using the credential provider chain
+func (o *tokenOptions) validate(conn *connOptions) []error {
+	if o.token == "" {
+		o.token = os.Getenv("OS_TOKEN")
+	}
+
+	if o.token == "" && o.access == "" {
+		c, err := (&pkg.ChainProvider{Providers: credentialProviders(o.profile, conn), Logger: conn.logger()}).Retrieve()
+		if err != nil {
+			return []error{err}
+		}
+		if c != nil {
+			o.access = c.Access
+		}
+	}
+
+	if o.token == "" && o.access == "" {
+		return []error{fmt.Errorf("Please define --token parameter, OS_TOKEN environment variable or EC2 access (--access parameter, AWS_ACCESS_KEY_ID or EC2_ACCESS_KEY environment variable, an AWS profile or clouds.yaml) to use a cached token")}
+	}
+
+	return nil
+}
+
+// cache returns a token cache, which returns tokens until they expire
+func (o *tokenOptions) cache(logger pkg.ILogger) (*pkg.TokenCache, error) {
+	cache, err := pkg.NewTokenCache(o.cacheDir, 0)
+	if err != nil {
+		return nil, err
+	}
+	cache.Logger = logger
+	return cache, nil
+}
+
+// resolve returns the --token value or a token cached for the --access
+func (o *tokenOptions) resolve(authURL string, logger pkg.ILogger) (string, error) {
+	if o.token != "" {
+		return o.token, nil
+	}
+
+	cache, err := o.cache(logger)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := cache.Get(authURL, o.access)
+	if err != nil {
+		return "", err
+	}
+	if res == nil {
+		return "", fmt.Errorf("there is no valid cached token for the %q access", o.access)
+	}
+
+	return res.TokenID, nil
+}
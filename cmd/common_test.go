@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+func TestCredentialProviders(t *testing.T) {
+	credsFile := writeTempFile(t, "credentials", `[ci]
+aws_access_key_id = ci-access
+aws_secret_access_key = ci-secret
+`)
+	setenv(t, "AWS_SHARED_CREDENTIALS_FILE", credsFile)
+	setenv(t, "AWS_CONFIG_FILE", credsFile+".missing")
+	setenv(t, "AWS_PROFILE", "")
+	setenv(t, "OS_CLOUD", "")
+	setenv(t, "AWS_ACCESS_KEY_ID", "env-access")
+	setenv(t, "AWS_SECRET_ACCESS_KEY", "env-secret")
+
+	cases := []struct {
+		name     string
+		profile  string
+		cloud    *pkg.Cloud
+		expected string
+	}{
+		{"environment", "", nil, "env-access"},
+		{"cloud", "", &pkg.Cloud{Name: "demo", Access: "cloud-access", Secret: "cloud-secret"}, "cloud-access"},
+		// an explicit profile overrides both the cloud and the environment
+		{"profile", "ci", &pkg.Cloud{Name: "demo", Access: "cloud-access", Secret: "cloud-secret"}, "ci-access"},
+		{"profile without cloud", "ci", nil, "ci-access"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conn := &connOptions{cloud: c.cloud}
+			if c.cloud != nil {
+				conn.cloudName = c.cloud.Name
+			}
+
+			creds, err := (&pkg.ChainProvider{Providers: credentialProviders(c.profile, conn)}).Retrieve()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds == nil || creds.Access != c.expected {
+				t.Errorf("expected %s access, got %+v", c.expected, creds)
+			}
+		})
+	}
+}
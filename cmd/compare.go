@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"text/tabwriter"
+)
+
+// metricComparison describes a load test metric, which is compared between
+// two runs
+type metricComparison struct {
+	name string
+	// higherIsBetter is true for metrics like throughput
+	higherIsBetter bool
+	value          func(r *intervalResult) float64
+}
+
+var comparedMetrics = []metricComparison{
+	{"throughput_rps", true, func(r *intervalResult) float64 { return r.Throughput }},
+	{"error_rate", false, func(r *intervalResult) float64 { return r.ErrorRate }},
+	{"latency_mean_ms", false, func(r *intervalResult) float64 { return r.Latency.Mean }},
+	{"latency_p50_ms", false, func(r *intervalResult) float64 { return r.Latency.P50 }},
+	{"latency_p90_ms", false, func(r *intervalResult) float64 { return r.Latency.P90 }},
+	{"latency_p99_ms", false, func(r *intervalResult) float64 { return r.Latency.P99 }},
+	{"latency_p99.9_ms", false, func(r *intervalResult) float64 { return r.Latency.P999 }},
+	{"latency_max_ms", false, func(r *intervalResult) float64 { return r.Latency.Max }},
+}
+
+// runCompare compares two load test result files and exits with a non-zero
+// code, when a regression beyond the threshold is detected
+func runCompare(args []string) {
+	var threshold float64
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	fs.Float64Var(&threshold, "threshold", 10, "regression threshold in percent")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s compare [flags] <base results> <new results>\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	base, err := readResults(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	cur, err := readResults(fs.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if regressions := compareResults(os.Stdout, base, cur, threshold); regressions > 0 {
+		log.Printf("%d regressions beyond %.1f%% detected", regressions, threshold)
+		os.Exit(1)
+	}
+}
+
+// compareResults prints a comparison table of the results summaries and
+// returns the amount of regressions beyond the threshold
+func compareResults(out io.Writer, base, cur *loadResults, threshold float64) int {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "METRIC\tBASE\tNEW\tCHANGE\t\n")
+
+	var regressions int
+	for _, m := range comparedMetrics {
+		b := m.value(base.Summary)
+		n := m.value(cur.Summary)
+		change := relativeChange(b, n)
+
+		status := ""
+		worse := change > threshold
+		if m.higherIsBetter {
+			worse = -change > threshold
+		}
+		if worse {
+			status = "REGRESSION"
+			regressions++
+		}
+
+		// a change from zero has no relative value
+		changeStr := "n/a"
+		if !math.IsInf(change, 0) {
+			changeStr = fmt.Sprintf("%+.1f%%", change)
+		}
+
+		fmt.Fprintf(w, "%s\t%.3f\t%.3f\t%s\t%s\n", m.name, b, n, changeStr, status)
+	}
+	w.Flush()
+
+	return regressions
+}
+
+// relativeChange returns a change in percent. A change from zero returns an
+// infinity with the sign of the change, which exceeds any threshold
+func relativeChange(base, cur float64) float64 {
+	if base == 0 {
+		switch {
+		case cur > 0:
+			return math.Inf(1)
+		case cur < 0:
+			return math.Inf(-1)
+		}
+		return 0
+	}
+	return 100 * (cur - base) / base
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+var credentialsActions = []string{"list", "create", "show", "delete"}
+
+// runCredentials manages OS-EC2 credentials of the authenticated user
+func runCredentials(args []string) {
+	var action string
+	if len(args) > 0 {
+		action = args[0]
+		args = args[1:]
+	}
+
+	var conn connOptions
+	var cred credOptions
+	var cache cacheOptions
+	var format string
+	var allProjects bool
+	fs := flag.NewFlagSet("credentials "+action, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s credentials list|create [flags]\n       %s credentials show|delete [flags] ACCESS\n\nFlags:\n", os.Args[0], os.Args[0])
+		fs.PrintDefaults()
+	}
+	conn.addFlags(fs)
+	cred.addFlags(fs)
+	cache.addFlags(fs)
+	fs.StringVar(&format, "format", "text", "output format: text or json")
+	fs.BoolVar(&allProjects, "all-projects", false, "list credentials of all user projects, not only the authenticated project")
+	fs.Parse(args)
+
+	errors := append(conn.validate(), cred.validate(&conn)...)
+
+	var access string
+	switch action {
+	case "list", "create":
+		if fs.NArg() > 0 {
+			errors = append(errors, fmt.Errorf("unexpected arguments: %q", fs.Args()))
+		}
+	case "show", "delete":
+		if fs.NArg() != 1 {
+			errors = append(errors, fmt.Errorf("Please define the credential access ID"))
+		}
+		access = fs.Arg(0)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if format != "text" && format != "json" {
+		errors = append(errors, fmt.Errorf("unsupported output format %q, supported formats: text, json", format))
+	}
+
+	exitOnErrors(errors)
+
+	identityClient, err := conn.newIdentityClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := conn.context()
+	defer cancel()
+
+	res, err := cache.authenticate(ctx, identityClient, &cred.ao, conn.logger())
+	if err != nil {
+		exitWithError(err)
+	}
+
+	client := pkg.WithContext(ctx, pkg.WithToken(identityClient, res.TokenID))
+
+	var v interface{}
+	switch action {
+	case "list":
+		var creds []pkg.EC2Credential
+		creds, err = pkg.ListEC2Credentials(client, res.UserID)
+		if !allProjects {
+			creds = filterEC2Credentials(creds, res.ProjectID)
+		}
+		v = creds
+	case "create":
+		v, err = pkg.CreateEC2Credential(client, res.UserID, res.ProjectID)
+	case "show":
+		v, err = pkg.GetEC2Credential(client, res.UserID, access)
+	case "delete":
+		err = pkg.DeleteEC2Credential(client, res.UserID, access)
+	}
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if action == "delete" {
+		fmt.Printf("Credential %s deleted\n", access)
+		return
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	switch v := v.(type) {
+	case []pkg.EC2Credential:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ACCESS\tPROJECT\tUSER\tTRUST")
+		for _, c := range v {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Access, c.TenantID, c.UserID, c.TrustID)
+		}
+		w.Flush()
+	case *pkg.EC2Credential:
+		fmt.Printf("Access: %s\n", v.Access)
+		fmt.Printf("Secret: %s\n", v.Secret)
+		fmt.Printf("Project: %s\n", v.TenantID)
+		fmt.Printf("User: %s\n", v.UserID)
+		if v.TrustID != "" {
+			fmt.Printf("Trust: %s\n", v.TrustID)
+		}
+	}
+}
+
+// filterEC2Credentials returns credentials of the project
+func filterEC2Credentials(creds []pkg.EC2Credential, projectID string) []pkg.EC2Credential {
+	result := []pkg.EC2Credential{}
+	for _, c := range creds {
+		if c.TenantID == projectID {
+			result = append(result, c)
+		}
+	}
+	return result
+}
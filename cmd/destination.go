@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+const (
+	destAWS    = "aws"
+	destDotenv = "dotenv"
+	destShell  = "shell"
+	destJSON   = "json"
+)
+
+var destinationFormats = []string{destAWS, destDotenv, destShell, destJSON}
+
+// credentialDestination represents CLI options used to store EC2
+// credentials
+type credentialDestination struct {
+	path    string
+	format  string
+	profile string
+}
+
+func (d *credentialDestination) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&d.path, "destination", "", "file to write the new EC2 credential to (default stdout)")
+	fs.StringVar(&d.format, "destination-format", destDotenv, "destination format: "+strings.Join(destinationFormats, ", "))
+	fs.StringVar(&d.profile, "destination-profile", "default", "profile to update, when the destination format is "+destAWS)
+}
+
+func (d *credentialDestination) validate() []error {
+	for _, v := range destinationFormats {
+		if d.format == v {
+			if d.format == destAWS && d.path == "" {
+				return []error{fmt.Errorf("--destination parameter is required for the %q destination format", destAWS)}
+			}
+			return nil
+		}
+	}
+	return []error{fmt.Errorf("unsupported destination format %q, supported formats: %s", d.format, strings.Join(destinationFormats, ", "))}
+}
+
+// render returns the destination content with the credential. The aws format
+// updates the profile in the existing content.
+func (d *credentialDestination) render(old []byte, access, secret string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch d.format {
+	case destAWS:
+		return updateINISection(old, d.profile, [][2]string{
+			{"aws_access_key_id", access},
+			{"aws_secret_access_key", secret},
+		}), nil
+	case destJSON:
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(map[string]string{
+			"access": access,
+			"secret": secret,
+		})
+		return buf.Bytes(), err
+	case destShell:
+		fmt.Fprintf(&buf, "export AWS_ACCESS_KEY_ID=%s\n", shellQuote(access))
+		fmt.Fprintf(&buf, "export AWS_SECRET_ACCESS_KEY=%s\n", shellQuote(secret))
+	default:
+		fmt.Fprintf(&buf, "AWS_ACCESS_KEY_ID=%s\n", access)
+		fmt.Fprintf(&buf, "AWS_SECRET_ACCESS_KEY=%s\n", secret)
+	}
+	return buf.Bytes(), nil
+}
+
+// write writes the credential to the destination file and returns a
+// function, which restores the previous file content
+func (d *credentialDestination) write(access, secret string) (func() error, error) {
+	old, err := ioutil.ReadFile(d.path)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	data, err := d.render(old, access, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pkg.WriteFileAtomic(d.path, data, 0600); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		if !existed {
+			return os.Remove(d.path)
+		}
+		return pkg.WriteFileAtomic(d.path, old, 0600)
+	}, nil
+}
+
+// print writes the credential to w, the aws format is rendered as a
+// standalone profile
+func (d *credentialDestination) print(w io.Writer, access, secret string) error {
+	data, err := d.render(nil, access, secret)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// updateINISection sets keys in the INI file section, other sections, keys
+// and comments are preserved. A missing section is appended.
+func updateINISection(data []byte, section string, keys [][2]string) []byte {
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+
+	set := make(map[string]bool, len(keys))
+	var result []string
+	// index to insert missing keys at, -1 when the section is not found
+	insert := -1
+	inSection := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			inSection = strings.TrimSpace(trimmed[1:len(trimmed)-1]) == section
+			if inSection {
+				result = append(result, line)
+				insert = len(result)
+				continue
+			}
+		}
+		if inSection {
+			if i := strings.IndexAny(trimmed, "=:"); i > 0 {
+				name := strings.TrimSpace(trimmed[:i])
+				for _, kv := range keys {
+					if name == kv[0] {
+						line = kv[0] + " = " + kv[1]
+						set[name] = true
+					}
+				}
+			}
+			if trimmed != "" {
+				insert = len(result) + 1
+			}
+		}
+		result = append(result, line)
+	}
+
+	var missing []string
+	for _, kv := range keys {
+		if !set[kv[0]] {
+			missing = append(missing, kv[0]+" = "+kv[1])
+		}
+	}
+
+	if insert < 0 {
+		if len(result) > 0 {
+			result = append(result, "")
+		}
+		result = append(result, "["+section+"]")
+		result = append(result, missing...)
+	} else if len(missing) > 0 {
+		result = append(result[:insert], append(missing, result[insert:]...)...)
+	}
+
+	return []byte(strings.Join(result, "\n") + "\n")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUpdateINISection(t *testing.T) {
+	keys := [][2]string{
+		{"aws_access_key_id", "new-access"},
+		{"aws_secret_access_key", "new-secret"},
+	}
+
+	cases := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{
+			name: "empty file",
+			data: "",
+			expected: `[ci]
+aws_access_key_id = new-access
+aws_secret_access_key = new-secret
+`,
+		},
+		{
+			name: "replace section keys",
+			data: `[default]
+aws_access_key_id = default-access
+aws_secret_access_key = default-secret
+
+[ci]
+aws_access_key_id=old-access
+aws_secret_access_key = old-secret
+region = RegionOne
+`,
+			expected: `[default]
+aws_access_key_id = default-access
+aws_secret_access_key = default-secret
+
+[ci]
+aws_access_key_id = new-access
+aws_secret_access_key = new-secret
+region = RegionOne
+`,
+		},
+		{
+			name: "append section",
+			data: `[default]
+aws_access_key_id = default-access
+aws_secret_access_key = default-secret`,
+			expected: `[default]
+aws_access_key_id = default-access
+aws_secret_access_key = default-secret
+
+[ci]
+aws_access_key_id = new-access
+aws_secret_access_key = new-secret
+`,
+		},
+		{
+			name: "keep comments and add missing keys",
+			data: `# managed by ec2auth
+[ ci ]
+; rotated weekly
+aws_access_key_id = old-access
+
+[other]
+# other comment
+aws_access_key_id = other-access
+`,
+			expected: `# managed by ec2auth
+[ ci ]
+; rotated weekly
+aws_access_key_id = new-access
+aws_secret_access_key = new-secret
+
+[other]
+# other comment
+aws_access_key_id = other-access
+`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := string(updateINISection([]byte(c.data), "ci", keys))
+			if got != c.expected {
+				t.Errorf("unexpected result:\n%s\nexpected:\n%s", got, c.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+// exitCodes maps authentication error classes to CLI exit codes, all other
+// errors exit with 1
+var exitCodes = map[pkg.ErrorClass]int{
+	pkg.ErrUnauthorized:    10,
+	pkg.ErrForbidden:       11,
+	pkg.ErrRateLimited:     12,
+	pkg.ErrServer:          13,
+	pkg.ErrClient:          14,
+	pkg.ErrTLS:             20,
+	pkg.ErrDNS:             21,
+	pkg.ErrConnectTimeout:  22,
+	pkg.ErrResponseTimeout: 23,
+	pkg.ErrConnection:      24,
+}
+
+// exitWithError prints the error and exits with an error class specific code
+func exitWithError(err error) {
+	log.Print(err)
+
+	var e *pkg.AuthError
+	if errors.As(err, &e) {
+		if code, ok := exitCodes[e.Class]; ok {
+			os.Exit(code)
+		}
+	}
+
+	os.Exit(1)
+}
+
+// errorType returns a short error description used to group errors
+func errorType(err error) string {
+	var e *pkg.AuthError
+	if errors.As(err, &e) {
+		return e.Type()
+	}
+	return fmt.Sprintf("%T", err)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+const (
+	execInfoEnv           = "KUBERNETES_EXEC_INFO"
+	execCredentialKind    = "ExecCredential"
+	defaultExecAPIVersion = "client.authentication.k8s.io/v1beta1"
+)
+
+var supportedExecAPIVersions = map[string]struct{}{
+	"client.authentication.k8s.io/v1alpha1": {},
+	"client.authentication.k8s.io/v1beta1":  {},
+	"client.authentication.k8s.io/v1":       {},
+}
+
+// execCredential represents a client-go ExecCredential object
+type execCredential struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Status     *execCredentialStatus `json:"status,omitempty"`
+}
+
+type execCredentialStatus struct {
+	ExpirationTimestamp *time.Time `json:"expirationTimestamp,omitempty"`
+	Token               string     `json:"token"`
+}
+
+// execAPIVersion detects the ExecCredential API version requested by
+// client-go in the KUBERNETES_EXEC_INFO environment variable
+func execAPIVersion() (string, error) {
+	v := os.Getenv(execInfoEnv)
+	if v == "" {
+		return defaultExecAPIVersion, nil
+	}
+
+	var info execCredential
+	err := json.Unmarshal([]byte(v), &info)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the %s environment variable: %v", execInfoEnv, err)
+	}
+
+	if info.APIVersion == "" {
+		return defaultExecAPIVersion, nil
+	}
+
+	if _, ok := supportedExecAPIVersions[info.APIVersion]; !ok {
+		return "", fmt.Errorf("unsupported ExecCredential API version: %s", info.APIVersion)
+	}
+
+	return info.APIVersion, nil
+}
+
+func printExecCredential(w io.Writer, apiVersion string, res *pkg.AuthResult) error {
+	cred := execCredential{
+		APIVersion: apiVersion,
+		Kind:       execCredentialKind,
+		Status: &execCredentialStatus{
+			Token: res.TokenID,
+		},
+	}
+	if !res.ExpiresAt.IsZero() {
+		// client-go metav1.Time has a second precision, so the expiry is
+		// rounded down to stay within the token lifetime
+		t := res.ExpiresAt.UTC().Truncate(time.Second)
+		cred.Status.ExpirationTimestamp = &t
+	}
+
+	return json.NewEncoder(w).Encode(cred)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+// setenv sets an environment variable until the test finishes, an empty
+// value unsets the variable
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+
+	old, ok := os.LookupEnv(key)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+}
+
+func TestPrintExecCredential(t *testing.T) {
+	expiresAt := time.Date(2020, 1, 1, 3, 0, 0, 123456000, time.FixedZone("UTC+2", 2*3600))
+
+	cases := []struct {
+		name       string
+		execInfo   string
+		apiVersion string
+		res        *pkg.AuthResult
+		expiration interface{}
+	}{
+		{
+			name:       "default",
+			apiVersion: defaultExecAPIVersion,
+			res:        &pkg.AuthResult{TokenID: "gAAAA", ExpiresAt: expiresAt},
+			expiration: "2020-01-01T01:00:00Z",
+		},
+		{
+			name:       "v1",
+			execInfo:   `{"apiVersion": "client.authentication.k8s.io/v1", "kind": "ExecCredential", "spec": {"interactive": false}}`,
+			apiVersion: "client.authentication.k8s.io/v1",
+			res:        &pkg.AuthResult{TokenID: "gAAAA", ExpiresAt: expiresAt},
+			expiration: "2020-01-01T01:00:00Z",
+		},
+		{
+			name:       "no expiry",
+			apiVersion: defaultExecAPIVersion,
+			res:        &pkg.AuthResult{TokenID: "gAAAA"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			setenv(t, execInfoEnv, c.execInfo)
+
+			p, err := newOutputPrinter(formatExecCred, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := p.Print(&buf, c.res); err != nil {
+				t.Fatal(err)
+			}
+
+			var got struct {
+				APIVersion string                 `json:"apiVersion"`
+				Kind       string                 `json:"kind"`
+				Status     map[string]interface{} `json:"status"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.APIVersion != c.apiVersion || got.Kind != "ExecCredential" {
+				t.Errorf("unexpected apiVersion %q or kind %q", got.APIVersion, got.Kind)
+			}
+			if got.Status["token"] != "gAAAA" {
+				t.Errorf("unexpected token: %v", got.Status["token"])
+			}
+			if got.Status["expirationTimestamp"] != c.expiration {
+				t.Errorf("unexpected expirationTimestamp: %v", got.Status["expirationTimestamp"])
+			}
+			if v, ok := got.Status["expirationTimestamp"].(string); ok {
+				if _, err := time.Parse(time.RFC3339, v); err != nil {
+					t.Errorf("expirationTimestamp is not RFC3339: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestExecAPIVersionErrors(t *testing.T) {
+	for _, v := range []string{"invalid", `{"apiVersion": "client.authentication.k8s.io/v2"}`} {
+		setenv(t, execInfoEnv, v)
+		if _, err := newOutputPrinter(formatExecCred, "", ""); err == nil {
+			t.Errorf("%s: expected an error", v)
+		}
+	}
+}
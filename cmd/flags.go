@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// keyValueFlag is a repeatable "key=value" CLI flag
+type keyValueFlag map[string]string
+
+func (f *keyValueFlag) String() string {
+	if f == nil || *f == nil {
+		return ""
+	}
+	var pairs []string
+	for k, v := range *f {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f *keyValueFlag) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("%q must be in a key=value format", value)
+	}
+	if *f == nil {
+		*f = make(keyValueFlag)
+	}
+	(*f)[kv[0]] = kv[1]
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+const (
+	formatToken    = "token"
+	formatJSON     = "json"
+	formatShell    = "shell"
+	formatDotenv   = "dotenv"
+	formatTemplate = "template"
+	formatExecCred = "exec-credential"
+)
+
+var outputFormats = []string{formatToken, formatJSON, formatShell, formatDotenv, formatTemplate, formatExecCred}
+
+// templateData is passed to a user defined output template
+type templateData struct {
+	*pkg.AuthResult
+	AuthURL string
+}
+
+// outputPrinter renders the authentication result in a requested format
+type outputPrinter struct {
+	format  string
+	authURL string
+	tmpl    *template.Template
+	// ExecCredential API version requested by client-go
+	execAPIVersion string
+}
+
+func newOutputPrinter(format, tmpl, authURL string) (*outputPrinter, error) {
+	p := &outputPrinter{
+		format:  format,
+		authURL: authURL,
+	}
+
+	if format != formatTemplate && tmpl != "" {
+		return nil, fmt.Errorf("--template parameter can be used only with the %q format", formatTemplate)
+	}
+
+	switch format {
+	case formatToken, formatJSON, formatShell, formatDotenv:
+	case formatTemplate:
+		if tmpl == "" {
+			return nil, fmt.Errorf("please define the --template parameter for the %q format", formatTemplate)
+		}
+		t, err := template.New("output").Funcs(template.FuncMap{
+			"join": strings.Join,
+		}).Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the output template: %v", err)
+		}
+		p.tmpl = t
+	case formatExecCred:
+		v, err := execAPIVersion()
+		if err != nil {
+			return nil, err
+		}
+		p.execAPIVersion = v
+	default:
+		return nil, fmt.Errorf("unsupported output format %q, supported formats: %s", format, strings.Join(outputFormats, ", "))
+	}
+
+	return p, nil
+}
+
+// envVars returns a list of environment variables, which can be consumed by
+// the openstack CLI
+func (p *outputPrinter) envVars(res *pkg.AuthResult) [][2]string {
+	return [][2]string{
+		{"OS_TOKEN", res.TokenID},
+		{"OS_AUTH_TYPE", "token"},
+		{"OS_AUTH_URL", p.authURL},
+		{"OS_PROJECT_ID", res.ProjectID},
+	}
+}
+
+func (p *outputPrinter) Print(w io.Writer, res *pkg.AuthResult) error {
+	switch p.format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	case formatShell:
+		for _, v := range p.envVars(res) {
+			_, err := fmt.Fprintf(w, "export %s=%s\n", v[0], shellQuote(v[1]))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case formatDotenv:
+		for _, v := range p.envVars(res) {
+			_, err := fmt.Fprintf(w, "%s=%s\n", v[0], v[1])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case formatTemplate:
+		err := p.tmpl.Execute(w, templateData{res, p.authURL})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w)
+		return err
+	case formatExecCred:
+		return printExecCredential(w, p.execAPIVersion, res)
+	}
+
+	_, err := fmt.Fprintln(w, res.TokenID)
+	return err
+}
+
+// shellQuote quotes a string to be safely evaluated by a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+func TestShellQuote(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected string
+	}{
+		{"", `''`},
+		{"plain", `'plain'`},
+		{"it's", `'it'\''s'`},
+		{"$HOME `id` $(id)", "'$HOME `id` $(id)'"},
+		{"line1\nline2", "'line1\nline2'"},
+		{"''", `''\'''\'''`},
+	}
+
+	for _, c := range cases {
+		if got := shellQuote(c.in); got != c.expected {
+			t.Errorf("%q: expected %s, got %s", c.in, c.expected, got)
+		}
+	}
+}
+
+func TestPrintEnv(t *testing.T) {
+	res := &pkg.AuthResult{TokenID: "gAAAA'$TOKEN\n", ProjectID: "p1"}
+	authURL := "https://keystone.example.com/v3?a=$b&c='d'"
+
+	cases := []struct {
+		format   string
+		expected string
+	}{
+		{formatShell, `export OS_TOKEN='gAAAA'\''$TOKEN
+'
+export OS_AUTH_TYPE='token'
+export OS_AUTH_URL='https://keystone.example.com/v3?a=$b&c='\''d'\'''
+export OS_PROJECT_ID='p1'
+`},
+		// dotenv values are not quoted
+		{formatDotenv, `OS_TOKEN=gAAAA'$TOKEN
+OS_AUTH_TYPE=token
+OS_AUTH_URL=https://keystone.example.com/v3?a=$b&c='d'
+OS_PROJECT_ID=p1
+`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.format, func(t *testing.T) {
+			p, err := newOutputPrinter(c.format, "", authURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			r := *res
+			if c.format == formatDotenv {
+				r.TokenID = strings.TrimSuffix(r.TokenID, "\n")
+			}
+			if err := p.Print(&buf, &r); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != c.expected {
+				t.Errorf("unexpected output:\n%s\nexpected:\n%s", buf.String(), c.expected)
+			}
+		})
+	}
+
+	// the shell output must evaluate to the original values
+	if _, err := exec.LookPath("sh"); err != nil || runtime.GOOS == "windows" {
+		return
+	}
+	p, err := newOutputPrinter(formatShell, "", authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := p.Print(&buf, res); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString(`printf '%s|%s|%s' "$OS_TOKEN" "$OS_AUTH_TYPE" "$OS_AUTH_URL"`)
+	out, err := exec.Command("sh", "-c", buf.String()).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := res.TokenID + "|token|" + authURL; string(out) != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+}
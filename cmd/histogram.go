@@ -0,0 +1,168 @@
+package main
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// histogram is a concurrency safe log-linear latency histogram with a
+// microsecond resolution and a relative error below 0.2%, similar to HDR
+// histograms
+type histogram struct {
+	mu     sync.Mutex
+	counts []uint64
+	total  uint64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+const (
+	// histSubBuckets is an amount of linear sub-buckets in each power of two
+	// range
+	histSubBuckets = 512
+	// histMaxValue is the highest trackable value in microseconds, larger
+	// values are clamped
+	histMaxValue = uint64(time.Hour / time.Microsecond)
+)
+
+func histIndex(v uint64) int {
+	if v < 2*histSubBuckets {
+		return int(v)
+	}
+	e := uint(bits.Len64(v)) - 10
+	return histSubBuckets*int(e) + int(v>>e)
+}
+
+// histValue returns the highest value, which is counted in a bucket
+func histValue(i int) uint64 {
+	if i < 2*histSubBuckets {
+		return uint64(i)
+	}
+	e := uint(i/histSubBuckets - 1)
+	sub := uint64(i - histSubBuckets*int(e))
+	return (sub+1)<<e - 1
+}
+
+func newHistogram() *histogram {
+	return &histogram{
+		counts: make([]uint64, histIndex(histMaxValue)+1),
+	}
+}
+
+func (h *histogram) Record(d time.Duration) {
+	v := uint64(d / time.Microsecond)
+	if d < 0 {
+		v = 0
+	}
+	if v > histMaxValue {
+		v = histMaxValue
+	}
+
+	h.mu.Lock()
+	h.counts[histIndex(v)]++
+	if h.total == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.total++
+	h.sum += d
+	h.mu.Unlock()
+}
+
+// Merge adds all values from another histogram
+func (h *histogram) Merge(o *histogram) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, v := range o.counts {
+		h.counts[i] += v
+	}
+	if o.total > 0 && (h.total == 0 || o.min < h.min) {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+	h.total += o.total
+	h.sum += o.sum
+}
+
+// Snapshot returns a copy of the histogram and resets it
+func (h *histogram) Snapshot() *histogram {
+	n := newHistogram()
+
+	h.mu.Lock()
+	h.counts, n.counts = n.counts, h.counts
+	n.total, n.sum, n.min, n.max = h.total, h.sum, h.min, h.max
+	h.total, h.sum, h.min, h.max = 0, 0, 0, 0
+	h.mu.Unlock()
+
+	return n
+}
+
+func (h *histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.total
+}
+
+func (h *histogram) Max() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.max
+}
+
+func (h *histogram) Min() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.min
+}
+
+func (h *histogram) Mean() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// Quantile returns a value at a quantile in the [0, 1] range
+func (h *histogram) Quantile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.total == 0 {
+		return 0
+	}
+
+	rank := uint64(q*float64(h.total) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	// the maximum is tracked exactly, including clamped values
+	if rank >= h.total {
+		return h.max
+	}
+
+	var seen uint64
+	for i, v := range h.counts {
+		seen += v
+		if seen >= rank {
+			d := time.Duration(histValue(i)) * time.Microsecond
+			// the bucket upper bound can't exceed the observed maximum
+			if d > h.max {
+				d = h.max
+			}
+			return d
+		}
+	}
+
+	return h.max
+}
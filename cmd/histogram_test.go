@@ -0,0 +1,174 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// histMaxError is the maximum relative error of a recorded value
+const histMaxError = 1.0 / histSubBuckets
+
+func TestHistogramBuckets(t *testing.T) {
+	var values []uint64
+	for v := uint64(0); v < 4*histSubBuckets; v++ {
+		values = append(values, v)
+	}
+	// sub-bucket edges of every power of two range
+	for e := uint(11); (uint64(1) << e) <= histMaxValue; e++ {
+		p := uint64(1) << e
+		values = append(values, p-2, p-1, p, p+1, p+p/2-1, p+p/2)
+	}
+	values = append(values, histMaxValue-1, histMaxValue)
+
+	for _, v := range values {
+		i := histIndex(v)
+		upper := histValue(i)
+		if upper < v {
+			t.Fatalf("%d: bucket %d upper bound %d is below the value", v, i, upper)
+		}
+		if v > 0 && float64(upper-v)/float64(v) > histMaxError {
+			t.Errorf("%d: bucket %d upper bound %d exceeds the relative error", v, i, upper)
+		}
+		// the upper bound belongs to the bucket and the next value doesn't
+		if histIndex(upper) != i || histIndex(upper+1) != i+1 {
+			t.Errorf("%d: bucket %d has an invalid upper bound %d", v, i, upper)
+		}
+	}
+
+	if n := len(newHistogram().counts); n != histIndex(histMaxValue)+1 {
+		t.Errorf("unexpected amount of buckets: %d", n)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	uniform := func(h *histogram) {
+		for v := 1; v <= 10000; v++ {
+			h.Record(time.Duration(v) * time.Microsecond)
+		}
+	}
+
+	cases := []struct {
+		name   string
+		record func(h *histogram)
+		// expected quantiles without the histogram error
+		p50, p90, p99, p999, max time.Duration
+	}{
+		{
+			name:   "uniform",
+			record: uniform,
+			p50:    5000 * time.Microsecond,
+			p90:    9000 * time.Microsecond,
+			p99:    9900 * time.Microsecond,
+			p999:   9990 * time.Microsecond,
+			max:    10000 * time.Microsecond,
+		},
+		{
+			name: "constant",
+			record: func(h *histogram) {
+				for i := 0; i < 100; i++ {
+					h.Record(42 * time.Millisecond)
+				}
+			},
+			p50:  42 * time.Millisecond,
+			p90:  42 * time.Millisecond,
+			p99:  42 * time.Millisecond,
+			p999: 42 * time.Millisecond,
+			max:  42 * time.Millisecond,
+		},
+		{
+			name: "long tail",
+			record: func(h *histogram) {
+				for i := 0; i < 9980; i++ {
+					h.Record(time.Millisecond)
+				}
+				for i := 0; i < 19; i++ {
+					h.Record(time.Second)
+				}
+				h.Record(time.Minute)
+			},
+			p50:  time.Millisecond,
+			p90:  time.Millisecond,
+			p99:  time.Millisecond,
+			p999: time.Second,
+			max:  time.Minute,
+		},
+		{
+			name: "clamped",
+			record: func(h *histogram) {
+				h.Record(-time.Second)
+				h.Record(2 * time.Hour)
+			},
+			p50:  0,
+			p90:  2 * time.Hour,
+			p99:  2 * time.Hour,
+			p999: 2 * time.Hour,
+			max:  2 * time.Hour,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := newHistogram()
+			c.record(h)
+
+			for _, q := range []struct {
+				q        float64
+				expected time.Duration
+			}{
+				{0.5, c.p50},
+				{0.9, c.p90},
+				{0.99, c.p99},
+				{0.999, c.p999},
+				{1, c.max},
+			} {
+				got := h.Quantile(q.q)
+				if got < q.expected || float64(got-q.expected) > float64(q.expected)*histMaxError {
+					t.Errorf("p%g: expected %s within %.2f%%, got %s", q.q*100, q.expected, histMaxError*100, got)
+				}
+			}
+			if h.Max() != c.max {
+				t.Errorf("expected max %s, got %s", c.max, h.Max())
+			}
+		})
+	}
+
+	if q := newHistogram().Quantile(0.5); q != 0 {
+		t.Errorf("expected zero quantile of an empty histogram, got %s", q)
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a, b, all := newHistogram(), newHistogram(), newHistogram()
+	for v := 1; v <= 1000; v++ {
+		d := time.Duration(v) * time.Millisecond
+		if v%3 == 0 {
+			a.Record(d)
+		} else {
+			b.Record(d)
+		}
+		all.Record(d)
+	}
+
+	merged := newHistogram()
+	merged.Merge(a)
+	merged.Merge(newHistogram())
+	merged.Merge(b)
+
+	if merged.Count() != all.Count() || merged.Min() != time.Millisecond || merged.Max() != time.Second || merged.Mean() != all.Mean() {
+		t.Errorf("unexpected count %d, min %s, max %s or mean %s", merged.Count(), merged.Min(), merged.Max(), merged.Mean())
+	}
+	for _, q := range []float64{0, 0.5, 0.9, 0.99, 0.999, 1} {
+		if got, expected := merged.Quantile(q), all.Quantile(q); got != expected {
+			t.Errorf("p%g: expected %s, got %s", q*100, expected, got)
+		}
+	}
+
+	// a snapshot moves the values and resets the histogram
+	s := merged.Snapshot()
+	if s.Count() != all.Count() || s.Quantile(0.5) != all.Quantile(0.5) {
+		t.Errorf("unexpected snapshot count %d or median %s", s.Count(), s.Quantile(0.5))
+	}
+	if merged.Count() != 0 || merged.Max() != 0 || merged.Quantile(0.5) != 0 {
+		t.Errorf("histogram is not reset after a snapshot")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+// runInspect validates a token using the Keystone token validation API and
+// prints its metadata
+func runInspect(args []string) {
+	var conn connOptions
+	var tok tokenOptions
+	var format string
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	conn.addFlags(fs)
+	tok.addFlags(fs)
+	fs.StringVar(&format, "format", "text", "output format: text or json")
+	fs.Parse(args)
+
+	errors := append(conn.validate(), tok.validate(&conn)...)
+
+	if format != "text" && format != "json" {
+		errors = append(errors, fmt.Errorf("unsupported output format %q, supported formats: text, json", format))
+	}
+
+	exitOnErrors(errors)
+
+	identityClient, err := conn.newIdentityClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	token, err := tok.resolve(identityClient.IdentityEndpoint, conn.logger())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := conn.context()
+	defer cancel()
+
+	res, err := pkg.GetTokenWithContext(ctx, identityClient, token)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	fmt.Printf("User: %s (%s), domain: %s\n", res.Username, res.UserID, res.UserDomainName)
+	fmt.Printf("Project: %s (%s), domain: %s\n", res.Project, res.ProjectID, res.ProjectDomainName)
+	fmt.Printf("Roles: %s\n", strings.Join(res.RoleNames(), ", "))
+	fmt.Printf("Methods: %s\n", strings.Join(res.Methods, ", "))
+	fmt.Printf("Issued at: %s\n", res.IssuedAt.Format(time.RFC3339))
+	fmt.Printf("Expires at: %s\n", res.ExpiresAt.Format(time.RFC3339))
+	fmt.Printf("Expires in: %s\n", time.Until(res.ExpiresAt).Round(time.Second))
+}
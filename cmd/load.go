@@ -0,0 +1,405 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+// loadOptions represents load test CLI options
+type loadOptions struct {
+	threads  uint
+	rate     float64
+	duration time.Duration
+	requests uint64
+	interval time.Duration
+	showErr  bool
+	// output is a file to write the results to
+	output       string
+	outputFormat string
+	// metricsListen is an address to serve Prometheus metrics on
+	metricsListen string
+	// credentialsFile is a file with EC2 credentials to distribute requests
+	// across
+	credentialsFile string
+	distribution    string
+}
+
+func (o *loadOptions) validate() []error {
+	var errors []error
+	if o.threads == 0 {
+		if o.rate > 0 || o.duration > 0 || o.requests > 0 || o.credentialsFile != "" ||
+			o.output != "" || o.outputFormat != "" || o.metricsListen != "" {
+			errors = append(errors, fmt.Errorf("--rate, --duration, --requests, --credentials-file, --output, --output-format and --metrics-listen parameters require --threads"))
+		}
+		return errors
+	}
+
+	if o.rate < 0 {
+		errors = append(errors, fmt.Errorf("--rate must be positive"))
+	}
+
+	if o.interval <= 0 {
+		errors = append(errors, fmt.Errorf("--interval must be positive"))
+	}
+
+	if o.output != "" {
+		if o.outputFormat == "" {
+			o.outputFormat = resultsFormatFromPath(o.output)
+		}
+		if o.outputFormat != resultsJSON && o.outputFormat != resultsCSV {
+			errors = append(errors, fmt.Errorf("unsupported results format %q, supported formats: %s, %s", o.outputFormat, resultsJSON, resultsCSV))
+		}
+	}
+
+	return errors
+}
+
+// loadTest runs authentication requests either in a closed loop with a fixed
+// amount of threads, or in an open loop with a fixed rate
+type loadTest struct {
+	opts           loadOptions
+	identityClient *gophercloud.ServiceClient
+	ao             *ec2tokens.AuthOptions
+	// timeout is a single request timeout, zero means no timeout
+	timeout time.Duration
+
+	// amount of started requests, used to enforce the requests limit
+	started uint64
+	// per interval counters
+	ops uint64
+	fps uint64
+	// total counters
+	totalReq uint64
+	totalErr uint64
+	// amount of requests in progress
+	inFlight int64
+
+	lck          sync.RWMutex
+	errs         map[string]uint64
+	intervalErrs map[string]uint64
+
+	interval *histogram
+	total    *histogram
+
+	start      time.Time
+	lastReport time.Time
+	results    loadResults
+
+	// metrics is nil, when the metrics endpoint is disabled
+	metrics *loadMetrics
+	// pool is nil, when a single credential is used
+	pool *credentialPool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newLoadTest(opts loadOptions, identityClient *gophercloud.ServiceClient, ao *ec2tokens.AuthOptions, pool *credentialPool, conns *connCounter) *loadTest {
+	lt := &loadTest{
+		opts:           opts,
+		identityClient: identityClient,
+		ao:             ao,
+		pool:           pool,
+		errs:           make(map[string]uint64),
+		intervalErrs:   make(map[string]uint64),
+		interval:       newHistogram(),
+		total:          newHistogram(),
+		stop:           make(chan struct{}),
+	}
+
+	if opts.metricsListen != "" {
+		lt.metrics = newLoadMetrics(&lt.inFlight, conns)
+	}
+
+	return lt
+}
+
+func (lt *loadTest) Stop() {
+	lt.stopOnce.Do(func() {
+		close(lt.stop)
+	})
+}
+
+func (lt *loadTest) stopped() bool {
+	select {
+	case <-lt.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// next reserves a request within the requests limit
+func (lt *loadTest) next() bool {
+	if lt.opts.requests == 0 {
+		return true
+	}
+	if atomic.AddUint64(&lt.started, 1) > lt.opts.requests {
+		lt.Stop()
+		return false
+	}
+	return true
+}
+
+// auth performs a single request, the latency is measured since the
+// intended start time
+func (lt *loadTest) auth(intended time.Time) {
+	ao := lt.ao
+	var pc *poolCredential
+	if lt.pool != nil {
+		pc = lt.pool.pick()
+		ao = &pc.ao
+	}
+
+	ctx, cancel := withTimeout(lt.timeout)
+	atomic.AddInt64(&lt.inFlight, 1)
+	_, err := pkg.OpenStackEC2AuthWithContext(ctx, lt.identityClient, ao)
+	atomic.AddInt64(&lt.inFlight, -1)
+	cancel()
+	if pc != nil {
+		pc.record(err)
+	}
+	d := time.Since(intended)
+	lt.interval.Record(d)
+	if lt.metrics != nil {
+		lt.metrics.observe(d, err)
+	}
+	atomic.AddUint64(&lt.ops, 1)
+	if err == nil {
+		return
+	}
+
+	atomic.AddUint64(&lt.fps, 1)
+	errType := errorType(err)
+	lt.lck.Lock()
+	lt.errs[errType] += 1
+	lt.intervalErrs[errType] += 1
+	lt.lck.Unlock()
+}
+
+// closedLoop starts a new request as soon as the previous one is finished
+func (lt *loadTest) closedLoop(wg *sync.WaitGroup) {
+	for i := uint(0); i < lt.opts.threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !lt.stopped() && lt.next() {
+				lt.auth(time.Now())
+			}
+		}()
+	}
+}
+
+// openLoop schedules requests at a fixed rate. When all threads are busy,
+// requests are queued and the queue time is counted in the latency to avoid
+// the coordinated omission.
+func (lt *loadTest) openLoop(wg *sync.WaitGroup) {
+	queue := make(chan time.Time, lt.opts.threads)
+	for i := uint(0); i < lt.opts.threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for intended := range queue {
+				lt.auth(intended)
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(queue)
+
+		period := time.Duration(float64(time.Second) / lt.opts.rate)
+		start := time.Now()
+		for n := int64(0); ; n++ {
+			intended := start.Add(time.Duration(n) * period)
+			if d := time.Until(intended); d > 0 {
+				select {
+				case <-lt.stop:
+					return
+				case <-time.After(d):
+				}
+			}
+			if lt.stopped() || !lt.next() {
+				return
+			}
+			select {
+			case <-lt.stop:
+				return
+			case queue <- intended:
+			}
+		}
+	}()
+}
+
+// report prints interval stats and merges them into the total stats
+func (lt *loadTest) report() {
+	now := time.Now()
+	f := atomic.SwapUint64(&lt.fps, 0)
+	s := atomic.SwapUint64(&lt.ops, 0)
+	tS := atomic.AddUint64(&lt.totalReq, s)
+	tF := atomic.AddUint64(&lt.totalErr, f)
+	h := lt.interval.Snapshot()
+	lt.total.Merge(h)
+
+	lt.lck.Lock()
+	errs := lt.intervalErrs
+	lt.intervalErrs = make(map[string]uint64)
+	lt.lck.Unlock()
+
+	r := newIntervalResult(now, now.Sub(lt.start), now.Sub(lt.lastReport), s, f, h, errs)
+	r.Concurrency = lt.opts.threads
+	r.InFlight = atomic.LoadInt64(&lt.inFlight)
+	lt.results.Intervals = append(lt.results.Intervals, r)
+	lt.lastReport = now
+
+	var perc uint64
+	var tPerc uint64
+	if s > 0 {
+		perc = 100 * f / s
+	}
+	if tS > 0 {
+		tPerc = 100 * tF / tS
+	}
+	log.Printf("%.0f rps, %d failed (%d%%)", r.Throughput, f, perc)
+	log.Printf("total %d requests, %d failed: %d%%", tS, tF, tPerc)
+	log.Printf("latency %s", formatLatency(h))
+	lt.printErrors()
+}
+
+func (lt *loadTest) printErrors() {
+	if !lt.opts.showErr {
+		return
+	}
+
+	lt.lck.RLock()
+	defer lt.lck.RUnlock()
+	var keys []string
+	for k := range lt.errs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		log.Printf("ERROR: %s -> %d", k, lt.errs[k])
+	}
+}
+
+func (lt *loadTest) summary() {
+	defer func() {
+		if lt.pool != nil {
+			lt.pool.printSummary()
+		}
+	}()
+
+	now := time.Now()
+	elapsed := now.Sub(lt.start)
+	tS := atomic.LoadUint64(&lt.totalReq)
+	tF := atomic.LoadUint64(&lt.totalErr)
+	var tPerc uint64
+	if tS > 0 {
+		tPerc = 100 * tF / tS
+	}
+
+	lt.lck.RLock()
+	r := newIntervalResult(now, elapsed, elapsed, tS, tF, lt.total, lt.errs)
+	lt.lck.RUnlock()
+	r.Concurrency = lt.opts.threads
+	lt.results.Summary = &r
+	if lt.pool != nil {
+		lt.results.Credentials = lt.pool.results()
+	}
+
+	log.Printf("Summary:")
+	log.Printf("duration %s, %d requests, %.1f rps", elapsed.Round(time.Millisecond), tS, r.Throughput)
+	log.Printf("%d failed: %d%%", tF, tPerc)
+	log.Printf("latency %s, min=%s mean=%s", formatLatency(lt.total), lt.total.Min().Round(time.Microsecond), lt.total.Mean().Round(time.Microsecond))
+	lt.printErrors()
+}
+
+func formatLatency(h *histogram) string {
+	return fmt.Sprintf("p50=%s p90=%s p99=%s p99.9=%s max=%s",
+		h.Quantile(0.5),
+		h.Quantile(0.9),
+		h.Quantile(0.99),
+		h.Quantile(0.999),
+		h.Max().Round(time.Microsecond),
+	)
+}
+
+// Run runs the load test until the duration or requests limit is reached, or
+// until SIGINT or SIGTERM is received, and prints a summary
+func (lt *loadTest) Run() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	lt.start = time.Now()
+	lt.lastReport = lt.start
+	lt.results = loadResults{
+		StartedAt: lt.start,
+		Threads:   lt.opts.threads,
+		Rate:      lt.opts.rate,
+	}
+	if lt.metrics != nil {
+		serveMetrics(lt.opts.metricsListen, lt.metrics)
+		log.Printf("Serving metrics on http://%s/metrics", lt.opts.metricsListen)
+	}
+
+	wg := &sync.WaitGroup{}
+	if lt.opts.rate > 0 {
+		lt.openLoop(wg)
+	} else {
+		lt.closedLoop(wg)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var deadline <-chan time.Time
+	if lt.opts.duration > 0 {
+		deadline = time.After(lt.opts.duration)
+	}
+
+	ticker := time.NewTicker(lt.opts.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			lt.report()
+			continue
+		case <-deadline:
+			log.Printf("Duration limit reached, waiting for in-flight requests")
+		case s := <-sig:
+			log.Printf("Received %s, waiting for in-flight requests", s)
+		case <-done:
+		}
+		break
+	}
+
+	lt.Stop()
+	<-done
+	lt.report()
+	lt.summary()
+
+	if lt.opts.output != "" {
+		if err := writeResults(lt.opts.output, lt.opts.outputFormat, &lt.results); err != nil {
+			log.Fatalf("failed to write the results: %v", err)
+		}
+	}
+}
@@ -1,190 +1,156 @@
 package main
 
 import (
-	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
-	"net"
-	"net/http"
-	"net/url"
 	"os"
-	"sync"
-	"sync/atomic"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/gophercloud/gophercloud"
-	"github.com/gophercloud/gophercloud/openstack"
-	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
 	"github.com/kayrus/ec2auth/pkg"
 )
 
-func main() {
-	ao := &ec2tokens.AuthOptions{}
-	var authURL string
-	var host string
-	var debug bool
-	var showErr bool
-	var insecureTls bool
-	var threads uint
-	flag.StringVar(&authURL, "auth-url", "", "Keystone auth URL")
-	flag.StringVar(&host, "host", "", "override keystone HOST")
-	flag.StringVar(&ao.Access, "access", "", "EC2 access")
-	flag.StringVar(&ao.Secret, "secret", "", "EC2 secret")
-	flag.UintVar(&threads, "threads", 0, "Whether to run an infinite loop with an amount of threads")
-	flag.BoolVar(&insecureTls, "insecure-tls", false, "Whether to ignore server TLS certificate verification")
-	flag.BoolVar(&debug, "debug", false, "show debug logs")
-	flag.BoolVar(&showErr, "show-error", false, "show error type on auth failure")
-	flag.Parse()
-
-	if authURL == "" {
-		authURL = os.Getenv("OS_AUTH_URL")
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage: %s [command] [flags]\n\n", os.Args[0])
+	fmt.Fprintf(w, "Commands:\n")
+	var names []string
+	for k := range commands {
+		names = append(names, k)
 	}
-
-	if ao.Access == "" {
-		ao.Access = os.Getenv("AWS_ACCESS_KEY_ID")
+	sort.Strings(names)
+	for _, k := range names {
+		fmt.Fprintf(w, "  %s\n", k)
 	}
+	fmt.Fprintf(w, "\nWhen no command is specified, authenticates and prints a token.\n\nFlags:\n")
+	flag.PrintDefaults()
+}
 
-	if ao.Secret == "" {
-		ao.Secret = os.Getenv("AWS_SECRET_ACCESS_KEY")
-	}
+// commands is a list of subcommands, the default command authenticates and
+// prints a token
+var commands = map[string]func(args []string){
+	"s3token":     runS3Token,
+	"sign":        runSign,
+	"serve":       runServe,
+	"catalog":     runCatalog,
+	"compare":     runCompare,
+	"credentials": runCredentials,
+	"inspect":     runInspect,
+	"revoke":      runRevoke,
+	"rotate":      runRotate,
+	"agent":       runAgent,
+}
 
-	var errors []error
-	if authURL == "" {
-		errors = append(errors, fmt.Errorf("Please define --auth-url parameter or OS_AUTH_URL environment variable"))
+func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
 	}
 
-	if ao.Access == "" {
-		errors = append(errors, fmt.Errorf("Please define --access parameter or AWS_ACCESS_KEY_ID environment variable"))
-	}
+	var conn connOptions
+	var cred credOptions
+	var load loadOptions
+	var format string
+	var tmpl string
+	var cache cacheOptions
+	var agentSocket string
+	conn.addFlags(flag.CommandLine)
+	cred.addFlags(flag.CommandLine)
+	flag.UintVar(&load.threads, "threads", 0, "Whether to run a load test with an amount of threads")
+	flag.Float64Var(&load.rate, "rate", 0, "load test target rate in requests per second, 0 means a closed loop without a rate limit")
+	flag.DurationVar(&load.duration, "duration", 0, "load test duration, 0 means until interrupted")
+	flag.Uint64Var(&load.requests, "requests", 0, "load test total amount of requests, 0 means unlimited")
+	flag.DurationVar(&load.interval, "interval", time.Second, "load test stats report interval")
+	flag.StringVar(&load.output, "output", "", "file to write the load test results to")
+	flag.StringVar(&load.outputFormat, "output-format", "", "load test results format: json or csv (default detected by the --output file extension)")
+	flag.StringVar(&load.metricsListen, "metrics-listen", "", "address to serve load test Prometheus metrics on, e.g. 127.0.0.1:9100")
+	flag.StringVar(&load.credentialsFile, "credentials-file", "", "load test CSV (access,secret[,weight]) or JSON file with EC2 credentials to distribute requests across")
+	flag.StringVar(&load.distribution, "distribution", distRoundRobin, "load test credentials distribution: "+distRoundRobin+", "+distRandom+" or "+distWeighted)
+	flag.StringVar(&format, "format", formatToken, "output format: "+strings.Join(outputFormats, ", "))
+	flag.StringVar(&tmpl, "template", "", "Go text/template to render the output, when --format is template")
+	cache.addFlags(flag.CommandLine)
+	flag.StringVar(&agentSocket, "agent-socket", "", "token agent Unix socket to fetch the token from before authenticating directly (default "+agentSocketEnv+" environment variable)")
+	flag.BoolVar(&load.showErr, "show-error", false, "show error type on auth failure")
+	flag.Usage = usage
+	flag.Parse()
 
-	if ao.Secret == "" {
-		errors = append(errors, fmt.Errorf("Please define --secret parameter or AWS_SECRET_ACCESS_KEY environment variable"))
+	if agentSocket == "" {
+		agentSocket = os.Getenv(agentSocketEnv)
 	}
-
-	if errors != nil {
-		for _, e := range errors {
-			log.Printf("%s", e)
-		}
-		os.Exit(1)
+	// the load test always authenticates directly
+	if load.threads > 0 {
+		agentSocket = ""
 	}
 
-	provider, err := openstack.NewClient(authURL)
+	// credentials are required only when the agent is not available
+	cred.optional = load.credentialsFile != "" || agentSocket != ""
+	errors := append(conn.validate(), cred.validate(&conn)...)
+	errors = append(errors, load.validate()...)
+
+	printer, err := newOutputPrinter(format, tmpl, conn.authURL)
 	if err != nil {
-		log.Fatal(err)
+		errors = append(errors, err)
 	}
 
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: insecureTls,
-	}
-	var logger pkg.ILogger
-	if debug {
-		logger = &pkg.Logger{}
-	} else {
-		logger = &pkg.NoopLogger{}
-	}
-	provider.HTTPClient = http.Client{
-		Transport: &pkg.RoundTripper{
-			Rt: &http.Transport{
-				TLSClientConfig: tlsConfig,
-				Dial: (&net.Dialer{
-					Timeout:   5 * time.Second,
-					KeepAlive: 30 * time.Second,
-				}).Dial,
-				TLSHandshakeTimeout:   9 * time.Second,
-				ResponseHeaderTimeout: 9 * time.Second,
-				ExpectContinueTimeout: 1 * time.Second,
-			},
-			Host:   &host,
-			Logger: logger,
-		},
+	exitOnErrors(errors)
+
+	if load.metricsListen != "" {
+		conn.conns = &connCounter{}
 	}
 
-	identityClient, err := openstack.NewIdentityV3(provider, gophercloud.EndpointOpts{})
+	ao := &cred.ao
+	debug := conn.debug
+	logger := conn.logger()
+	identityClient, err := conn.newIdentityClient()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	lck := &sync.RWMutex{}
-	errs := make(map[string]uint64)
-	totalReq := new(uint64)
-	totalErr := new(uint64)
-	fps := new(uint64)
-	ops := new(uint64)
-	auth := func(limiter chan struct{}) {
-		atomic.AddUint64(ops, 1)
-		res, err := pkg.OpenStackEC2Auth(identityClient, ao)
-		if err != nil {
-			atomic.AddUint64(fps, 1)
-			if limiter == nil {
-				log.Print(err)
-				os.Exit(1)
+	if load.threads > 0 {
+		var pool *credentialPool
+		if load.credentialsFile != "" {
+			pool, err = loadCredentialPool(load.credentialsFile, load.distribution, *ao)
+			if err != nil {
+				log.Fatal(err)
 			}
-			if showErr {
-				var errType string
-				if e, ok := err.(*url.Error); ok && e.Err != nil {
-					errType = fmt.Sprintf("%v", e.Err)
-				} else {
-					errType = fmt.Sprintf("%T", err)
-				}
-				lck.Lock()
-				errs[errType] += 1
-				lck.Unlock()
-			}
-			<-limiter
-			return
 		}
+		lt := newLoadTest(load, identityClient, ao, pool, conn.conns)
+		lt.timeout = conn.timeout
+		lt.Run()
+		return
+	}
 
-		if debug {
-			log.Printf("User: %s", res.Username)
-			log.Printf("Project: %s", res.Project)
-		}
+	ctx, cancel := conn.context()
+	defer cancel()
 
-		if limiter == nil {
-			fmt.Println(res.TokenID)
-			return
+	var res *pkg.AuthResult
+	if agentSocket != "" {
+		res = agentToken(ctx, agentSocket, identityClient.IdentityEndpoint, ao.Access, conn.cloud, logger)
+	}
+	if res == nil {
+		if ao.Access == "" || ao.Secret == "" && ao.Signature == nil {
+			log.Fatalf("Token agent is not available, please define EC2 credentials to authenticate directly")
+		}
+		res, err = cache.authenticate(ctx, identityClient, ao, logger)
+		if err != nil {
+			exitWithError(err)
 		}
-
-		<-limiter
 	}
+	// the secret is not needed after the token is obtained
+	ao.Secret = ""
 
-	if threads == 0 {
-		auth(nil)
-		os.Exit(0)
+	if debug {
+		log.Printf("User: %s", res.Username)
+		log.Printf("Project: %s", res.Project)
+		log.Printf("Roles: %s", strings.Join(res.RoleNames(), ", "))
+		log.Printf("Expires at: %s", res.ExpiresAt)
 	}
 
-	go func() {
-		for {
-			select {
-			case <-time.After(1 * time.Second):
-				f := atomic.SwapUint64(fps, 0)
-				s := atomic.SwapUint64(ops, 0)
-				tS := atomic.AddUint64(totalReq, s)
-				tF := atomic.AddUint64(totalErr, f)
-				var perc uint64
-				var tPerc uint64
-				if s > 0 {
-					perc = 100 * f / s
-				}
-				if tS > 0 {
-					tPerc = 100 * tF / tS
-				}
-				log.Printf("%d rps, %d failed (%d%%)", s, f, perc)
-				log.Printf("total %d rps, %d failed: %d%%", tS, tF, tPerc)
-				if showErr {
-					lck.RLock()
-					for k, v := range errs {
-						log.Printf("ERROR: %s -> %d", k, v)
-					}
-					lck.RUnlock()
-				}
-			}
-		}
-	}()
-
-	limiter := make(chan struct{}, threads)
-	for {
-		limiter <- struct{}{}
-		go auth(limiter)
+	if err := printer.Print(os.Stdout, res); err != nil {
+		log.Fatal(err)
 	}
 }
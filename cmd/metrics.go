@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+// latencyBuckets are Prometheus histogram buckets in seconds
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// requestKey is a label set of the requests counter
+type requestKey struct {
+	status string
+	class  string
+}
+
+// loadMetrics exposes load test counters in the Prometheus text format
+type loadMetrics struct {
+	mu       sync.Mutex
+	requests map[requestKey]uint64
+	buckets  []uint64
+	sum      float64
+	count    uint64
+
+	// inFlight points to the load test in-flight requests counter
+	inFlight *int64
+	conns    *connCounter
+}
+
+func newLoadMetrics(inFlight *int64, conns *connCounter) *loadMetrics {
+	return &loadMetrics{
+		requests: make(map[requestKey]uint64),
+		buckets:  make([]uint64, len(latencyBuckets)),
+		inFlight: inFlight,
+		conns:    conns,
+	}
+}
+
+// statusCode returns an HTTP status code of the request, 0 means there was no
+// response
+func statusCode(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	var authErr *pkg.AuthError
+	if errors.As(err, &authErr) {
+		return authErr.StatusCode
+	}
+	var e gophercloud.StatusCodeError
+	if errors.As(err, &e) {
+		return e.GetStatusCode()
+	}
+	return 0
+}
+
+// errorClass returns an error class label, the HTTP status is exported as a
+// separate label
+func errorClass(err error) string {
+	var authErr *pkg.AuthError
+	if errors.As(err, &authErr) {
+		return string(authErr.Class)
+	}
+	return errorType(err)
+}
+
+func (m *loadMetrics) observe(d time.Duration, err error) {
+	key := requestKey{status: "none"}
+	if code := statusCode(err); code > 0 {
+		key.status = strconv.Itoa(code)
+	}
+	if err != nil {
+		key.class = errorClass(err)
+	}
+
+	s := d.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[key]++
+	m.count++
+	m.sum += s
+	for i, b := range latencyBuckets {
+		if s <= b {
+			m.buckets[i]++
+		}
+	}
+}
+
+// ServeHTTP implements the http.Handler interface
+func (m *loadMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+func (m *loadMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].status != keys[j].status {
+			return keys[i].status < keys[j].status
+		}
+		return keys[i].class < keys[j].class
+	})
+
+	fmt.Fprintf(w, "# HELP ec2auth_requests_total Total amount of EC2 authentication requests by HTTP status.\n")
+	fmt.Fprintf(w, "# TYPE ec2auth_requests_total counter\n")
+	byStatus := make(map[string]uint64)
+	for _, k := range keys {
+		byStatus[k.status] += m.requests[k]
+	}
+	statuses := make([]string, 0, len(byStatus))
+	for k := range byStatus {
+		statuses = append(statuses, k)
+	}
+	sort.Strings(statuses)
+	for _, s := range statuses {
+		fmt.Fprintf(w, "ec2auth_requests_total{status=%s} %d\n", quoteLabel(s), byStatus[s])
+	}
+
+	fmt.Fprintf(w, "# HELP ec2auth_request_failures_total Total amount of failed EC2 authentication requests by error class and HTTP status.\n")
+	fmt.Fprintf(w, "# TYPE ec2auth_request_failures_total counter\n")
+	for _, k := range keys {
+		if k.class == "" {
+			continue
+		}
+		fmt.Fprintf(w, "ec2auth_request_failures_total{class=%s,status=%s} %d\n", quoteLabel(k.class), quoteLabel(k.status), m.requests[k])
+	}
+
+	fmt.Fprintf(w, "# HELP ec2auth_request_duration_seconds EC2 authentication request latency.\n")
+	fmt.Fprintf(w, "# TYPE ec2auth_request_duration_seconds histogram\n")
+	for i, b := range latencyBuckets {
+		fmt.Fprintf(w, "ec2auth_request_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(b, 'g', -1, 64), m.buckets[i])
+	}
+	fmt.Fprintf(w, "ec2auth_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.count)
+	fmt.Fprintf(w, "ec2auth_request_duration_seconds_sum %s\n", strconv.FormatFloat(m.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "ec2auth_request_duration_seconds_count %d\n", m.count)
+	m.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP ec2auth_requests_in_flight Amount of EC2 authentication requests in progress.\n")
+	fmt.Fprintf(w, "# TYPE ec2auth_requests_in_flight gauge\n")
+	fmt.Fprintf(w, "ec2auth_requests_in_flight %d\n", atomic.LoadInt64(m.inFlight))
+
+	if m.conns != nil {
+		fmt.Fprintf(w, "# HELP ec2auth_connections_opened_total Total amount of opened Keystone connections.\n")
+		fmt.Fprintf(w, "# TYPE ec2auth_connections_opened_total counter\n")
+		fmt.Fprintf(w, "ec2auth_connections_opened_total %d\n", atomic.LoadUint64(&m.conns.opened))
+		fmt.Fprintf(w, "# HELP ec2auth_connections_open Amount of currently open Keystone connections.\n")
+		fmt.Fprintf(w, "# TYPE ec2auth_connections_open gauge\n")
+		fmt.Fprintf(w, "ec2auth_connections_open %d\n", atomic.LoadInt64(&m.conns.open))
+	}
+}
+
+// quoteLabel quotes a Prometheus label value
+func quoteLabel(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// serveMetrics starts an HTTP server with a /metrics endpoint
+func serveMetrics(listen string, m *loadMetrics) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	go func() {
+		log.Fatal(http.ListenAndServe(listen, mux))
+	}()
+}
+
+// connCounter counts opened and currently open connections
+type connCounter struct {
+	opened uint64
+	open   int64
+}
+
+// wrap wraps a dial function to count connections
+func (c *connCounter) wrap(dial func(network, addr string) (net.Conn, error)) func(network, addr string) (net.Conn, error) {
+	return func(network, addr string) (net.Conn, error) {
+		conn, err := dial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		atomic.AddUint64(&c.opened, 1)
+		atomic.AddInt64(&c.open, 1)
+		return &countedConn{Conn: conn, counter: c}, nil
+	}
+}
+
+type countedConn struct {
+	net.Conn
+	counter *connCounter
+	once    sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() {
+		atomic.AddInt64(&c.counter.open, -1)
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+func TestLoadMetricsLabels(t *testing.T) {
+	var inFlight int64
+	m := newLoadMetrics(&inFlight, nil)
+
+	m.observe(time.Millisecond, nil)
+	m.observe(time.Millisecond, &pkg.AuthError{Class: pkg.ErrUnauthorized, StatusCode: 401})
+	m.observe(time.Millisecond, fmt.Errorf("wrapped: %w", &pkg.AuthError{Class: pkg.ErrServer, StatusCode: 503}))
+	m.observe(time.Millisecond, &pkg.AuthError{Class: pkg.ErrConnection, Err: fmt.Errorf("connection refused")})
+
+	var buf bytes.Buffer
+	m.write(&buf)
+
+	for _, v := range []string{
+		`ec2auth_requests_total{status="200"} 1`,
+		`ec2auth_requests_total{status="401"} 1`,
+		`ec2auth_request_failures_total{class="unauthorized",status="401"} 1`,
+		`ec2auth_request_failures_total{class="server_error",status="503"} 1`,
+		`ec2auth_request_failures_total{class="connection",status="none"} 1`,
+	} {
+		if !strings.Contains(buf.String(), v) {
+			t.Errorf("metrics don't contain %s:\n%s", v, buf.String())
+		}
+	}
+}
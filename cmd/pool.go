@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+)
+
+const (
+	distRoundRobin = "round-robin"
+	distRandom     = "random"
+	distWeighted   = "weighted"
+)
+
+// poolCredential is an EC2 credential used in the load test
+type poolCredential struct {
+	Access string  `json:"access"`
+	Secret string  `json:"secret"`
+	Weight float64 `json:"weight"`
+
+	ao      ec2tokens.AuthOptions
+	success uint64
+	failure uint64
+}
+
+// credentialPool distributes load test requests across multiple EC2
+// credentials
+type credentialPool struct {
+	creds        []*poolCredential
+	distribution string
+	counter      uint64
+	// cumulative weights used by the weighted distribution
+	cumulative []float64
+}
+
+// loadCredentialPool reads EC2 credentials from a JSON or CSV file. Each
+// credential inherits the signature options from the base auth options.
+func loadCredentialPool(path, distribution string, base ec2tokens.AuthOptions) (*credentialPool, error) {
+	switch distribution {
+	case distRoundRobin, distRandom, distWeighted:
+	default:
+		return nil, fmt.Errorf("unsupported distribution %q, supported distributions: %s, %s, %s", distribution, distRoundRobin, distRandom, distWeighted)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds []*poolCredential
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &creds)
+	} else {
+		creds, err = parseCredentialsCSV(string(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %v", path, err)
+	}
+
+	if len(creds) == 0 {
+		return nil, fmt.Errorf("%q doesn't contain credentials", path)
+	}
+
+	p := &credentialPool{
+		creds:        creds,
+		distribution: distribution,
+		cumulative:   make([]float64, len(creds)),
+	}
+
+	var total float64
+	for i, c := range creds {
+		if c.Access == "" || c.Secret == "" {
+			return nil, fmt.Errorf("%q: credential %d: access and secret must be set", path, i+1)
+		}
+		if c.Weight < 0 {
+			return nil, fmt.Errorf("%q: credential %d: weight must not be negative", path, i+1)
+		}
+		if c.Weight == 0 {
+			c.Weight = 1
+		}
+		total += c.Weight
+		p.cumulative[i] = total
+
+		c.ao = base
+		c.ao.Access = c.Access
+		c.ao.Secret = c.Secret
+		logRedactor.add(c.Secret)
+	}
+
+	return p, nil
+}
+
+// parseCredentialsCSV parses "access,secret[,weight]" lines, an optional
+// header and lines starting with "#" are skipped
+func parseCredentialsCSV(data string) ([]*poolCredential, error) {
+	r := csv.NewReader(strings.NewReader(data))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var creds []*poolCredential
+	for i, rec := range records {
+		if i == 0 && len(rec) > 0 && strings.EqualFold(rec[0], "access") {
+			continue
+		}
+		if len(rec) < 2 || len(rec) > 3 {
+			return nil, fmt.Errorf("line %d: expected access,secret[,weight] columns", i+1)
+		}
+		c := &poolCredential{
+			Access: rec[0],
+			Secret: rec[1],
+		}
+		if len(rec) == 3 && rec[2] != "" {
+			c.Weight, err = strconv.ParseFloat(rec[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid weight: %v", i+1, err)
+			}
+		}
+		creds = append(creds, c)
+	}
+
+	return creds, nil
+}
+
+// pick returns the next credential according to the distribution
+func (p *credentialPool) pick() *poolCredential {
+	switch p.distribution {
+	case distRandom:
+		return p.creds[rand.Intn(len(p.creds))]
+	case distWeighted:
+		v := rand.Float64() * p.cumulative[len(p.cumulative)-1]
+		i := sort.SearchFloat64s(p.cumulative, v)
+		if i >= len(p.creds) {
+			i = len(p.creds) - 1
+		}
+		return p.creds[i]
+	}
+
+	n := atomic.AddUint64(&p.counter, 1) - 1
+	return p.creds[n%uint64(len(p.creds))]
+}
+
+func (c *poolCredential) record(err error) {
+	if err != nil {
+		atomic.AddUint64(&c.failure, 1)
+		return
+	}
+	atomic.AddUint64(&c.success, 1)
+}
+
+// credentialResult represents per credential load test results
+type credentialResult struct {
+	Access   string `json:"access"`
+	Requests uint64 `json:"requests"`
+	Failures uint64 `json:"failures"`
+}
+
+func (p *credentialPool) results() []credentialResult {
+	res := make([]credentialResult, len(p.creds))
+	for i, c := range p.creds {
+		s := atomic.LoadUint64(&c.success)
+		f := atomic.LoadUint64(&c.failure)
+		res[i] = credentialResult{
+			Access:   c.Access,
+			Requests: s + f,
+			Failures: f,
+		}
+	}
+	return res
+}
+
+func (p *credentialPool) printSummary() {
+	for _, r := range p.results() {
+		var perc uint64
+		if r.Requests > 0 {
+			perc = 100 * r.Failures / r.Requests
+		}
+		log.Printf("credential %s: %d requests, %d failed (%d%%)", r.Access, r.Requests, r.Failures, perc)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+)
+
+// redactMask replaces secrets in the log output
+const redactMask = "***"
+
+// redactor masks registered secrets in the log output, which includes debug
+// logs and errors. Secrets aren't stored in plaintext: the output is scanned
+// for substrings of registered lengths, which SHA-256 digests match. Only
+// substrings starting with the first byte of a secret of the same length are
+// hashed.
+type redactor struct {
+	mu sync.RWMutex
+	w  io.Writer
+	// lengths are registered secret lengths indexed by the first secret byte
+	// in a descending order, so the longest secret is masked first
+	lengths [256][]int
+	digests map[[sha256.Size]byte]struct{}
+}
+
+var logRedactor = &redactor{w: os.Stderr}
+
+func init() {
+	log.SetOutput(logRedactor)
+}
+
+// add registers a secret to be masked, empty values are ignored
+func (r *redactor) add(v string) {
+	if v == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.digests == nil {
+		r.digests = make(map[[sha256.Size]byte]struct{})
+	}
+	r.digests[sha256.Sum256([]byte(v))] = struct{}{}
+
+	lengths := r.lengths[v[0]]
+	for _, l := range lengths {
+		if l == len(v) {
+			return
+		}
+	}
+	lengths = append(lengths, len(v))
+	sort.Sort(sort.Reverse(sort.IntSlice(lengths)))
+	r.lengths[v[0]] = lengths
+}
+
+// redact returns p with registered secrets masked
+func (r *redactor) redact(p []byte) []byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.digests) == 0 {
+		return p
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(p))
+	for i := 0; i < len(p); {
+		matched := 0
+		for _, l := range r.lengths[p[i]] {
+			if i+l > len(p) {
+				continue
+			}
+			if _, ok := r.digests[sha256.Sum256(p[i:i+l])]; ok {
+				matched = l
+				break
+			}
+		}
+		if matched > 0 {
+			buf.WriteString(redactMask)
+			i += matched
+			continue
+		}
+		buf.WriteByte(p[i])
+		i++
+	}
+	return buf.Bytes()
+}
+
+// Write implements the io.Writer interface, log.Logger writes each message
+// using a single Write call
+func (r *redactor) Write(p []byte) (int, error) {
+	if _, err := r.w.Write(r.redact(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
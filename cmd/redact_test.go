@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	var buf bytes.Buffer
+	r := &redactor{w: &buf}
+	r.add("")
+	r.add("c558d9401a6943bbbb77a83ce910e5a5")
+	r.add("short")
+	r.add("shortest")
+	r.add("p@ss word")
+	r.add(url.QueryEscape("p@ss word"))
+
+	cases := []struct {
+		in       string
+		expected string
+	}{
+		{"no secrets", "no secrets"},
+		{"secret c558d9401a6943bbbb77a83ce910e5a5 in the middle", "secret *** in the middle"},
+		{"c558d9401a6943bbbb77a83ce910e5a5c558d9401a6943bbbb77a83ce910e5a5", "******"},
+		{"shortshort and short", "****** and ***"},
+		{`{"secret": "p@ss word"}`, `{"secret": "***"}`},
+		{"?secret=p%40ss+word&x=1", "?secret=***&x=1"},
+		{"shor", "shor"},
+		{"shortest shorter", "*** ***er"},
+	}
+
+	for _, c := range cases {
+		buf.Reset()
+		n, err := r.Write([]byte(c.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(c.in) {
+			t.Errorf("%q: expected %d written bytes, got %d", c.in, len(c.in), n)
+		}
+		if buf.String() != c.expected {
+			t.Errorf("%q: expected %q, got %q", c.in, c.expected, buf.String())
+		}
+	}
+}
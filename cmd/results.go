@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	resultsJSON = "json"
+	resultsCSV  = "csv"
+
+	// csvTotal is a "time" column value of the CSV summary row
+	csvTotal = "total"
+)
+
+// loadResults represents load test results, which can be stored in a file
+// and compared with another run
+type loadResults struct {
+	StartedAt time.Time        `json:"started_at"`
+	Threads   uint             `json:"threads"`
+	Rate      float64          `json:"rate,omitempty"`
+	Intervals []intervalResult `json:"intervals"`
+	Summary   *intervalResult  `json:"summary"`
+	// Credentials contains per credential results, when a credential
+	// pool is used
+	Credentials []credentialResult `json:"credentials,omitempty"`
+}
+
+// intervalResult represents stats of a single report interval or the whole
+// run
+type intervalResult struct {
+	Time        time.Time         `json:"time"`
+	Elapsed     float64           `json:"elapsed_seconds"`
+	Duration    float64           `json:"duration_seconds"`
+	Requests    uint64            `json:"requests"`
+	Failures    uint64            `json:"failures"`
+	Throughput  float64           `json:"throughput_rps"`
+	ErrorRate   float64           `json:"error_rate"`
+	Concurrency uint              `json:"concurrency"`
+	InFlight    int64             `json:"in_flight"`
+	Errors      map[string]uint64 `json:"errors,omitempty"`
+	Latency     latencyResult     `json:"latency_ms"`
+}
+
+// latencyResult contains latency stats in milliseconds
+type latencyResult struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	P999 float64 `json:"p99.9"`
+	Max  float64 `json:"max"`
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func newIntervalResult(now time.Time, elapsed, duration time.Duration, requests, failures uint64, h *histogram, errs map[string]uint64) intervalResult {
+	r := intervalResult{
+		Time:     now,
+		Elapsed:  elapsed.Seconds(),
+		Duration: duration.Seconds(),
+		Requests: requests,
+		Failures: failures,
+		Latency: latencyResult{
+			Min:  ms(h.Min()),
+			Mean: ms(h.Mean()),
+			P50:  ms(h.Quantile(0.5)),
+			P90:  ms(h.Quantile(0.9)),
+			P99:  ms(h.Quantile(0.99)),
+			P999: ms(h.Quantile(0.999)),
+			Max:  ms(h.Max()),
+		},
+	}
+
+	if duration > 0 {
+		r.Throughput = float64(requests) / duration.Seconds()
+	}
+	if requests > 0 {
+		r.ErrorRate = float64(failures) / float64(requests)
+	}
+	if len(errs) > 0 {
+		r.Errors = make(map[string]uint64, len(errs))
+		for k, v := range errs {
+			r.Errors[k] = v
+		}
+	}
+
+	return r
+}
+
+func resultsFormatFromPath(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return resultsCSV
+	}
+	return resultsJSON
+}
+
+func writeResults(path, format string, res *loadResults) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if format == resultsCSV {
+		w := csv.NewWriter(f)
+		w.Write(csvHeader)
+		for _, v := range res.Intervals {
+			w.Write(v.csvRecord(v.Time.Format(time.RFC3339Nano)))
+		}
+		if res.Summary != nil {
+			w.Write(res.Summary.csvRecord(csvTotal))
+		}
+		w.Flush()
+		err = w.Error()
+	} else {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(res)
+	}
+
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+var csvHeader = []string{
+	"time", "elapsed_seconds", "duration_seconds", "requests", "failures",
+	"throughput_rps", "error_rate", "concurrency", "in_flight",
+	"latency_min_ms", "latency_mean_ms", "latency_p50_ms", "latency_p90_ms",
+	"latency_p99_ms", "latency_p99.9_ms", "latency_max_ms", "errors",
+}
+
+func (r *intervalResult) csvRecord(t string) []string {
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	// errors are stored as a "class=count;class=count" list
+	var errs []string
+	for k, v := range r.Errors {
+		errs = append(errs, fmt.Sprintf("%s=%d", k, v))
+	}
+	sort.Strings(errs)
+
+	return []string{
+		t,
+		f(r.Elapsed),
+		f(r.Duration),
+		strconv.FormatUint(r.Requests, 10),
+		strconv.FormatUint(r.Failures, 10),
+		f(r.Throughput),
+		f(r.ErrorRate),
+		strconv.FormatUint(uint64(r.Concurrency), 10),
+		strconv.FormatInt(r.InFlight, 10),
+		f(r.Latency.Min),
+		f(r.Latency.Mean),
+		f(r.Latency.P50),
+		f(r.Latency.P90),
+		f(r.Latency.P99),
+		f(r.Latency.P999),
+		f(r.Latency.Max),
+		strings.Join(errs, ";"),
+	}
+}
+
+// parseCSVRecord parses a CSV row written by csvRecord
+func parseCSVRecord(rec []string) (*intervalResult, error) {
+	if len(rec) != len(csvHeader) {
+		return nil, fmt.Errorf("expected %d columns, got %d", len(csvHeader), len(rec))
+	}
+
+	var err error
+	f := func(s string) float64 {
+		v, e := strconv.ParseFloat(s, 64)
+		if e != nil && err == nil {
+			err = e
+		}
+		return v
+	}
+	u := func(s string) uint64 {
+		v, e := strconv.ParseUint(s, 10, 64)
+		if e != nil && err == nil {
+			err = e
+		}
+		return v
+	}
+
+	r := &intervalResult{
+		Elapsed:     f(rec[1]),
+		Duration:    f(rec[2]),
+		Requests:    u(rec[3]),
+		Failures:    u(rec[4]),
+		Throughput:  f(rec[5]),
+		ErrorRate:   f(rec[6]),
+		Concurrency: uint(u(rec[7])),
+		InFlight:    int64(f(rec[8])),
+		Latency: latencyResult{
+			Min:  f(rec[9]),
+			Mean: f(rec[10]),
+			P50:  f(rec[11]),
+			P90:  f(rec[12]),
+			P99:  f(rec[13]),
+			P999: f(rec[14]),
+			Max:  f(rec[15]),
+		},
+	}
+
+	if rec[16] != "" {
+		r.Errors = make(map[string]uint64)
+		for _, v := range strings.Split(rec[16], ";") {
+			i := strings.LastIndex(v, "=")
+			if i < 0 {
+				return nil, fmt.Errorf("invalid errors column: %q", rec[16])
+			}
+			r.Errors[v[:i]] = u(v[i+1:])
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if rec[0] != csvTotal {
+		if r.Time, err = time.Parse(time.RFC3339Nano, rec[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// readResults reads results written by writeResults
+func readResults(path string) (*loadResults, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var res loadResults
+	if resultsFormatFromPath(path) == resultsJSON {
+		if err := json.Unmarshal(data, &res); err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %v", path, err)
+		}
+		if res.Summary == nil {
+			return nil, fmt.Errorf("%q doesn't contain a summary", path)
+		}
+		return &res, nil
+	}
+
+	records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %v", path, err)
+	}
+	for i, rec := range records {
+		if i == 0 {
+			continue
+		}
+		r, err := parseCSVRecord(rec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q line %d: %v", path, i+1, err)
+		}
+		if rec[0] == csvTotal {
+			res.Summary = r
+			res.Threads = r.Concurrency
+			continue
+		}
+		res.Intervals = append(res.Intervals, *r)
+	}
+
+	if res.Summary == nil {
+		return nil, fmt.Errorf("%q doesn't contain a summary", path)
+	}
+
+	return &res, nil
+}
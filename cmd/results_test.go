@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testResults() *loadResults {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	interval := func(i int, requests, failures uint64, errs map[string]uint64) intervalResult {
+		return intervalResult{
+			Time:        start.Add(time.Duration(i) * time.Second).Add(123456789),
+			Elapsed:     float64(i),
+			Duration:    1,
+			Requests:    requests,
+			Failures:    failures,
+			Throughput:  float64(requests),
+			ErrorRate:   float64(failures) / float64(requests),
+			Concurrency: 8,
+			InFlight:    3,
+			Errors:      errs,
+			Latency:     latencyResult{Min: 1.5, Mean: 12.25, P50: 10, P90: 20.125, P99: 40, P999: 80.5, Max: 100.75},
+		}
+	}
+
+	summary := interval(2, 300, 3, map[string]uint64{"unauthorized": 1, "http_503=unavailable": 2})
+	summary.Time = time.Time{}
+
+	return &loadResults{
+		Threads: 8,
+		Intervals: []intervalResult{
+			interval(1, 100, 0, nil),
+			interval(2, 200, 3, map[string]uint64{"unauthorized": 1, "http_503=unavailable": 2}),
+		},
+		Summary: &summary,
+	}
+}
+
+func TestResultsRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ec2auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, format := range []string{resultsJSON, resultsCSV} {
+		t.Run(format, func(t *testing.T) {
+			expected := testResults()
+			path := filepath.Join(dir, "results."+format)
+			if resultsFormatFromPath(path) != format {
+				t.Fatalf("unexpected format of %s", path)
+			}
+			if err := writeResults(path, format, expected); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readResults(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("unexpected results:\n%+v\nexpected:\n%+v", got, expected)
+			}
+		})
+	}
+}
+
+func TestReadResultsErrors(t *testing.T) {
+	header := strings.Join(csvHeader, ",") + "\n"
+	row := "2020-01-01T00:00:00Z,1,1,100,0,100,0,8,3,1,2,3,4,5,6,7,"
+
+	cases := []struct {
+		name, data, err string
+	}{
+		{"no summary.json", `{"intervals": []}`, "doesn't contain a summary"},
+		{"invalid.json", `{`, "failed to parse"},
+		{"no summary.csv", header + row + "\n", "doesn't contain a summary"},
+		{"columns.csv", header + "total,1,2\n", "wrong number of fields"},
+		{"number.csv", header + strings.Replace(row, ",100,", ",x,", 1) + "\n", "line 2: strconv.ParseUint"},
+		{"time.csv", header + strings.Replace(row, "2020-01-01T00:00:00Z", "yesterday", 1) + "\n", "line 2"},
+		{"errors.csv", header + row + "unauthorized\n", "invalid errors column"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := readResults(writeTempFile(t, c.name, c.data))
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("expected %q error, got %v", c.err, err)
+			}
+		})
+	}
+
+	if _, err := readResults(filepath.Join(os.TempDir(), "ec2auth-missing.json")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestRelativeChange(t *testing.T) {
+	cases := []struct {
+		base, cur, expected float64
+	}{
+		{100, 110, 10},
+		{100, 50, -50},
+		{0.5, 0.5, 0},
+		{0, 0, 0},
+		{0, 0.1, math.Inf(1)},
+		{0, -1, math.Inf(-1)},
+	}
+
+	for _, c := range cases {
+		if got := relativeChange(c.base, c.cur); got != c.expected {
+			t.Errorf("%g -> %g: expected %g, got %g", c.base, c.cur, c.expected, got)
+		}
+	}
+}
+
+func TestCompareResults(t *testing.T) {
+	base := testResults()
+	base.Summary.ErrorRate = 0
+
+	cur := testResults()
+	cur.Summary.Throughput = base.Summary.Throughput * 0.95
+	cur.Summary.ErrorRate = 0.01
+	cur.Summary.Latency.P99 = base.Summary.Latency.P99 * 1.2
+	cur.Summary.Latency.Max = base.Summary.Latency.Max * 0.5
+
+	var buf bytes.Buffer
+	if n := compareResults(&buf, base, cur, 10); n != 2 {
+		t.Errorf("expected 2 regressions, got %d:\n%s", n, buf.String())
+	}
+
+	rows := make(map[string][]string)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n")[1:] {
+		fields := strings.Fields(line)
+		rows[fields[0]] = fields[1:]
+	}
+
+	expected := map[string][]string{
+		"throughput_rps":   {"300.000", "285.000", "-5.0%"},
+		"error_rate":       {"0.000", "0.010", "n/a", "REGRESSION"},
+		"latency_mean_ms":  {"12.250", "12.250", "+0.0%"},
+		"latency_p99_ms":   {"40.000", "48.000", "+20.0%", "REGRESSION"},
+		"latency_max_ms":   {"100.750", "50.375", "-50.0%"},
+		"latency_p99.9_ms": {"80.500", "80.500", "+0.0%"},
+	}
+	for name, fields := range expected {
+		if !reflect.DeepEqual(rows[name], fields) {
+			t.Errorf("%s: expected %v, got %v", name, fields, rows[name])
+		}
+	}
+
+	// an error rate change from zero exceeds any threshold
+	if n := compareResults(&bytes.Buffer{}, base, cur, 25); n != 1 {
+		t.Errorf("expected a single regression beyond 25%%, got %d", n)
+	}
+	cur.Summary.ErrorRate = 0
+	cur.Summary.Throughput = base.Summary.Throughput * 0.7
+	if n := compareResults(&bytes.Buffer{}, base, cur, 25); n != 1 {
+		t.Errorf("expected a throughput regression, got %d", n)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+// runRevoke revokes a token using the Keystone token revocation API and
+// purges it from the token cache
+func runRevoke(args []string) {
+	var conn connOptions
+	var tok tokenOptions
+	fs := flag.NewFlagSet("revoke", flag.ExitOnError)
+	conn.addFlags(fs)
+	tok.addFlags(fs)
+	fs.Parse(args)
+
+	exitOnErrors(append(conn.validate(), tok.validate(&conn)...))
+
+	identityClient, err := conn.newIdentityClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	authURL := identityClient.IdentityEndpoint
+	logger := conn.logger()
+
+	token, err := tok.resolve(authURL, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := conn.context()
+	defer cancel()
+
+	revokeErr := pkg.RevokeTokenWithContext(ctx, identityClient, token)
+
+	// the token is purged from the cache even if Keystone doesn't
+	// acknowledge the revocation, e.g. when it is already invalid
+	if err := purgeCachedToken(&tok, token, logger); err != nil {
+		log.Printf("failed to purge the token from the cache: %v", err)
+	}
+
+	if revokeErr != nil {
+		log.Printf("Keystone didn't acknowledge the token revocation")
+		exitWithError(revokeErr)
+	}
+
+	fmt.Println("Token revoked")
+}
+
+// purgeCachedToken deletes all cache entries, which contain the revoked
+// token, so it isn't returned by a later cached authentication
+func purgeCachedToken(tok *tokenOptions, token string, logger pkg.ILogger) error {
+	cache, err := tok.cache(logger)
+	if err != nil {
+		return err
+	}
+
+	n, err := cache.DeleteToken(token)
+	if n > 0 {
+		logger.RequestPrintf("Purged the token from %d cache entries", n)
+	}
+	return err
+}
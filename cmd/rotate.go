@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+// runRotate replaces the EC2 credential with a new one. The old credential
+// is deleted only after the new one is verified and stored, otherwise the new
+// credential is rolled back.
+func runRotate(args []string) {
+	var conn connOptions
+	var cred credOptions
+	var dest credentialDestination
+	var verifyTimeout time.Duration
+	fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+	conn.addFlags(fs)
+	cred.addFlags(fs)
+	dest.addFlags(fs)
+	fs.DurationVar(&verifyTimeout, "verify-timeout", 30*time.Second, "how long to wait for the new credential to become valid")
+	fs.Parse(args)
+
+	errors := append(conn.validate(), cred.validate(&conn)...)
+	errors = append(errors, dest.validate()...)
+
+	if cred.ao.Signature != nil {
+		errors = append(errors, fmt.Errorf("credential rotation requires the secret, a precalculated signature cannot be used"))
+	}
+
+	exitOnErrors(errors)
+
+	identityClient, err := conn.newIdentityClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := conn.context()
+	defer cancel()
+
+	res, err := pkg.OpenStackEC2AuthWithContext(ctx, identityClient, &cred.ao)
+	if err != nil {
+		exitWithError(err)
+	}
+	oldClient := pkg.WithToken(identityClient, res.TokenID)
+
+	newCred, err := pkg.CreateEC2Credential(pkg.WithContext(ctx, oldClient), res.UserID, res.ProjectID)
+	if err != nil {
+		exitWithError(err)
+	}
+	logRedactor.add(newCred.Secret)
+	log.Printf("Created a new credential %s", newCred.Access)
+
+	var restore func() error
+	rollback := func(err error) {
+		log.Printf("Credential rotation failed, rolling back")
+
+		if restore != nil {
+			if err := restore(); err != nil {
+				log.Printf("failed to restore %q: %v", dest.path, err)
+			}
+		}
+
+		// the original context may be already done
+		ctx, cancel := conn.context()
+		defer cancel()
+		if err := pkg.DeleteEC2Credential(pkg.WithContext(ctx, oldClient), res.UserID, newCred.Access); err != nil {
+			log.Printf("failed to delete the new credential %s, please delete it manually: %v", newCred.Access, err)
+		} else {
+			log.Printf("Deleted the new credential %s", newCred.Access)
+		}
+
+		exitWithError(err)
+	}
+
+	ao := cred.ao
+	ao.Access = newCred.Access
+	ao.Secret = newCred.Secret
+	newRes, err := verifyCredential(ctx, identityClient, &ao, verifyTimeout)
+	if err != nil {
+		rollback(fmt.Errorf("failed to verify the new credential: %w", err))
+	}
+	if newRes.UserID != res.UserID || newRes.ProjectID != res.ProjectID {
+		rollback(fmt.Errorf("the new credential is scoped to the %s user and %s project, expected %s and %s", newRes.UserID, newRes.ProjectID, res.UserID, res.ProjectID))
+	}
+	log.Printf("Verified the new credential %s", newCred.Access)
+
+	// the new credential must be stored before the old one is deleted
+	if dest.path != "" {
+		restore, err = dest.write(newCred.Access, newCred.Secret)
+		if err != nil {
+			rollback(fmt.Errorf("failed to write the new credential to %q: %v", dest.path, err))
+		}
+		log.Printf("Wrote the new credential to %q", dest.path)
+	} else if err := dest.print(os.Stdout, newCred.Access, newCred.Secret); err != nil {
+		rollback(fmt.Errorf("failed to print the new credential: %v", err))
+	}
+
+	// the old credential is deleted using the new token
+	newClient := pkg.WithContext(ctx, pkg.WithToken(identityClient, newRes.TokenID))
+	if err := pkg.DeleteEC2Credential(newClient, res.UserID, cred.ao.Access); err != nil {
+		rollback(fmt.Errorf("failed to delete the old credential %s: %w", cred.ao.Access, err))
+	}
+	log.Printf("Deleted the old credential %s", cred.ao.Access)
+}
+
+// verifyCredential authenticates using the new credential until it becomes
+// valid or the timeout expires
+func verifyCredential(ctx context.Context, identityClient *gophercloud.ServiceClient, ao *ec2tokens.AuthOptions, timeout time.Duration) (*pkg.AuthResult, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		res, err := pkg.OpenStackEC2AuthWithContext(ctx, identityClient, ao)
+		if err == nil {
+			return res, nil
+		}
+
+		// a new credential may be not propagated yet
+		e, ok := err.(*pkg.AuthError)
+		if !ok || e.Class != pkg.ErrUnauthorized || time.Now().After(deadline) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+	"github.com/kayrus/ec2auth/pkg"
+	"github.com/kayrus/ec2auth/pkg/fake"
+)
+
+func TestS3TokenSignatureV2(t *testing.T) {
+	var opts fake.Options
+	opts.Credentials = []fake.Credential{{
+		Access:      "AK1",
+		Secret:      "SK1",
+		UserID:      "u1",
+		UserName:    "alice",
+		ProjectID:   "p1",
+		ProjectName: "demo",
+	}}
+	srv := httptest.NewServer(fake.NewServer(opts))
+	defer srv.Close()
+	secretFile := writeTempFile(t, "secret", "SK1")
+
+	cases := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"default method", nil, ""},
+		{"sha1", []string{"--signature-method", ec2tokens.EC2CredentialsHmacSha1V2}, ""},
+		{"sha256", []string{"--signature-method", ec2tokens.EC2CredentialsHmacSha256V2}, "support only the HmacSHA1"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var opts s3TokenOptions
+			fs := flag.NewFlagSet("s3token", flag.ContinueOnError)
+			opts.addFlags(fs)
+			args := append([]string{
+				"--auth-url", srv.URL + "/v3",
+				"--access", "AK1",
+				"--secret-file", secretFile,
+				"--signature-version", "2",
+				"--verb", "GET",
+				"--path", "/bucket",
+				"--request-host", "s3.example.com",
+			}, c.args...)
+			if err := fs.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+
+			errs := opts.validate()
+			if c.err != "" {
+				if len(errs) != 1 || !strings.Contains(errs[0].Error(), c.err) {
+					t.Fatalf("expected %q error, got %v", c.err, errs)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+
+			client, err := opts.conn.newIdentityClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := pkg.ValidateS3Token(client, &opts.cred.ao)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Username != "alice" || res.Project != "demo" {
+				t.Errorf("unexpected user %q or project %q", res.Username, res.Project)
+			}
+		})
+	}
+}
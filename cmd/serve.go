@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/kayrus/ec2auth/pkg/fake"
+)
+
+// runServe runs a fake Keystone server
+func runServe(args []string) {
+	var listen string
+	var config string
+	var tlsCert string
+	var tlsKey string
+	var opts fake.Options
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.StringVar(&listen, "listen", "127.0.0.1:5000", "address to listen on")
+	fs.StringVar(&config, "config", "", "JSON file with EC2 credentials and an optional service catalog")
+	fs.StringVar(&tlsCert, "tls-cert", "", "TLS certificate file")
+	fs.StringVar(&tlsKey, "tls-key", "", "TLS key file")
+	fs.DurationVar(&opts.TokenTTL, "token-ttl", fake.DefaultTokenTTL, "issued token lifetime")
+	fs.DurationVar(&opts.Latency, "latency", 0, "latency added to every response")
+	fs.DurationVar(&opts.LatencyJitter, "latency-jitter", 0, "random latency up to this value added to every response")
+	fs.Float64Var(&opts.ErrorRate, "error-rate", 0, "fraction of requests, which fail with a 503 error")
+	fs.Float64Var(&opts.DropRate, "drop-rate", 0, "fraction of requests, which connection is dropped without a response")
+	fs.DurationVar(&opts.MaxTimeSkew, "max-time-skew", fake.DefaultMaxTimeSkew, "maximum signature V4 timestamp skew, 0 disables the check")
+	fs.Parse(args)
+
+	var errors []error
+	if config == "" {
+		errors = append(errors, fmt.Errorf("Please define --config parameter"))
+	}
+
+	if (tlsCert == "") != (tlsKey == "") {
+		errors = append(errors, fmt.Errorf("--tls-cert and --tls-key parameters must be set together"))
+	}
+
+	exitOnErrors(errors)
+
+	c, err := fake.LoadConfig(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts.Config = *c
+
+	scheme := "http"
+	if tlsCert != "" {
+		scheme = "https"
+	}
+
+	if opts.Catalog == nil {
+		opts.Catalog = []tokens.CatalogEntry{
+			{
+				ID:   "identity",
+				Name: "keystone",
+				Type: "identity",
+				Endpoints: []tokens.Endpoint{
+					{
+						ID:        "identity-public",
+						Interface: "public",
+						URL:       fmt.Sprintf("%s://%s/v3/", scheme, listen),
+					},
+				},
+			},
+		}
+	}
+
+	log.Printf("Serving a fake Keystone with %d EC2 credentials on %s://%s/v3", len(opts.Credentials), scheme, listen)
+
+	srv := fake.NewServer(opts)
+	if tlsCert != "" {
+		err = http.ListenAndServeTLS(listen, tlsCert, tlsKey, srv)
+	} else {
+		err = http.ListenAndServe(listen, srv)
+	}
+	log.Fatal(err)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+// runSign calculates an EC2 signature offline and prints all intermediate
+// values
+func runSign(args []string) {
+	var cred credOptions
+	var timestamp string
+	var format string
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	cred.addFlags(fs)
+	fs.StringVar(&timestamp, "timestamp", "", "signature V4 timestamp in RFC3339 or "+ec2tokens.EC2CredentialsTimestampFormatV4+" format (default now)")
+	fs.StringVar(&format, "format", "text", "output format: text or json")
+	fs.Parse(args)
+
+	errors := cred.validate(&connOptions{})
+
+	if timestamp != "" {
+		t, err := parseTimestamp(timestamp)
+		if err != nil {
+			errors = append(errors, err)
+		}
+		cred.ao.Timestamp = &t
+	}
+
+	if format != "text" && format != "json" {
+		errors = append(errors, fmt.Errorf("unsupported output format %q, supported formats: text, json", format))
+	}
+
+	exitOnErrors(errors)
+
+	res, err := pkg.SignEC2(&cred.ao)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	fmt.Printf("Signature version: %s\n", res.Version)
+	fmt.Printf("Signature method: %s\n", res.Method)
+	if res.Version == "4" {
+		fmt.Printf("Date: %s\n", res.Date.Format(ec2tokens.EC2CredentialsTimestampFormatV4))
+		fmt.Printf("Body hash: %s\n", res.BodyHash)
+		fmt.Printf("\nCanonical request:\n%s\n", res.CanonicalRequest)
+	}
+	fmt.Printf("\nString to sign:\n%s\n\n", res.StringToSign)
+	if res.Version == "4" {
+		fmt.Printf("Scope: %s\n", res.Scope)
+		fmt.Printf("Signing key: %s\n", res.SigningKey)
+	}
+	fmt.Printf("Signature: %s\n", res.Signature)
+	if res.Authorization != "" {
+		fmt.Printf("Authorization: %s\n", res.Authorization)
+	}
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	t, err := time.Parse(ec2tokens.EC2CredentialsTimestampFormatV4, s)
+	if err == nil {
+		return t, nil
+	}
+	t, err = time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("failed to parse %q timestamp: %v", s, err)
+	}
+	return t.UTC(), nil
+}
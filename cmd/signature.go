@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+)
+
+const signedHeadersKey = "X-Amz-SignedHeaders"
+
+// signatureOptions represents CLI options used to calculate an EC2 signature
+type signatureOptions struct {
+	version string
+	method  string
+
+	// requestFile is a JSON file with a signed request description, CLI
+	// flags take precedence over the file values
+	requestFile string
+	request     signedRequest
+}
+
+// signedRequest describes a request, which canonical form is signed by an
+// EC2 secret
+type signedRequest struct {
+	Region        string       `json:"region"`
+	Service       string       `json:"service"`
+	Verb          string       `json:"verb"`
+	Path          string       `json:"path"`
+	Host          string       `json:"host"`
+	Params        keyValueFlag `json:"params"`
+	Headers       keyValueFlag `json:"headers"`
+	SignedHeaders string       `json:"signed_headers"`
+	BodyHash      string       `json:"body_hash"`
+	BodyFile      string       `json:"body_file"`
+}
+
+// merge sets values, which are not set in the request
+func (r *signedRequest) merge(f signedRequest) {
+	mergeString := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	mergeString(&r.Region, f.Region)
+	mergeString(&r.Service, f.Service)
+	mergeString(&r.Verb, f.Verb)
+	mergeString(&r.Path, f.Path)
+	mergeString(&r.Host, f.Host)
+	mergeString(&r.SignedHeaders, f.SignedHeaders)
+	mergeString(&r.BodyHash, f.BodyHash)
+	mergeString(&r.BodyFile, f.BodyFile)
+	for k, v := range f.Params {
+		if _, ok := r.Params[k]; !ok {
+			r.Params.Set(k + "=" + v)
+		}
+	}
+	for k, v := range f.Headers {
+		if _, ok := r.Headers[k]; !ok {
+			r.Headers.Set(k + "=" + v)
+		}
+	}
+}
+
+// hashBody returns a hex encoded sha256 hash of a file, "-" means stdin
+func hashBody(path string) (string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", fmt.Errorf("failed to hash the %q body file: %v", path, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// apply validates signature options and sets them in the EC2 auth options
+func (o *signatureOptions) apply(ao *ec2tokens.AuthOptions) error {
+	r := o.request
+	if o.requestFile != "" {
+		data, err := ioutil.ReadFile(o.requestFile)
+		if err != nil {
+			return err
+		}
+		var f signedRequest
+		if err = json.Unmarshal(data, &f); err != nil {
+			return fmt.Errorf("failed to parse the %q request file: %v", o.requestFile, err)
+		}
+		r.merge(f)
+	}
+
+	ao.Region = r.Region
+	ao.Service = r.Service
+	ao.Verb = r.Verb
+	ao.Path = r.Path
+	ao.Host = r.Host
+
+	if len(r.Params) > 0 {
+		ao.Params = make(map[string]string, len(r.Params))
+		for k, v := range r.Params {
+			ao.Params[k] = v
+		}
+	}
+
+	if len(r.Headers) > 0 || r.SignedHeaders != "" || (r.Host != "" && o.version == "4") {
+		ao.Headers = make(map[string]string, len(r.Headers)+2)
+		for k, v := range r.Headers {
+			ao.Headers[k] = v
+		}
+		// signature V4 expects the Host inside the headers map
+		if _, ok := ao.Headers["Host"]; !ok && r.Host != "" {
+			ao.Headers["Host"] = r.Host
+		}
+		if r.SignedHeaders == "" {
+			r.SignedHeaders = defaultSignedHeaders(ao.Headers)
+		}
+		ao.Headers[signedHeadersKey] = r.SignedHeaders
+	}
+
+	if r.BodyHash != "" && r.BodyFile != "" {
+		return fmt.Errorf("body hash and body file cannot be set simultaneously")
+	}
+	if r.BodyFile != "" {
+		h, err := hashBody(r.BodyFile)
+		if err != nil {
+			return err
+		}
+		r.BodyHash = h
+	}
+	if r.BodyHash != "" {
+		ao.BodyHash = &r.BodyHash
+	}
+
+	switch o.version {
+	case "4":
+		if o.method != "" && o.method != ec2tokens.EC2CredentialsAwsHmacV4 {
+			return fmt.Errorf("unsupported signature V4 method: %s", o.method)
+		}
+	case "2":
+		switch o.method {
+		case "":
+			o.method = ec2tokens.EC2CredentialsHmacSha256V2
+		case ec2tokens.EC2CredentialsHmacSha1V2, ec2tokens.EC2CredentialsHmacSha256V2:
+		default:
+			return fmt.Errorf("unsupported signature V2 method: %s", o.method)
+		}
+		if ao.Params == nil {
+			ao.Params = make(map[string]string)
+		}
+		ao.Params["SignatureVersion"] = o.version
+		ao.Params["SignatureMethod"] = o.method
+	default:
+		return fmt.Errorf("unsupported signature version: %s", o.version)
+	}
+
+	return nil
+}
+
+// defaultSignedHeaders returns a sorted list of lower case header names, which
+// is used when signed headers are not set explicitly
+func defaultSignedHeaders(headers map[string]string) string {
+	var names []string
+	for k := range headers {
+		if k == signedHeadersKey {
+			continue
+		}
+		names = append(names, strings.ToLower(k))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ";")
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+// writeTempFile writes a file into a temporary directory, which is removed,
+// when the test finishes
+func writeTempFile(t *testing.T, name, data string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "ec2auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// applySignatureFlags parses the signature CLI flags and returns the
+// resulting EC2 auth options
+func applySignatureFlags(t *testing.T, args ...string) (*ec2tokens.AuthOptions, error) {
+	t.Helper()
+
+	var cred credOptions
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cred.addFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	err := cred.sigOpts.apply(&cred.ao)
+	return &cred.ao, err
+}
+
+func TestSignatureOptionsRequestFile(t *testing.T) {
+	requestFile := writeTempFile(t, "request.json", `{
+  "region": "RegionOne",
+  "service": "s3",
+  "verb": "PUT",
+  "path": "/bucket/key",
+  "host": "s3.example.com",
+  "params": {"acl": "", "versionId": "file"},
+  "headers": {"X-Amz-Date": "20200101T000000Z", "Content-Type": "text/plain"},
+  "body_hash": "file-hash"
+}`)
+
+	ao, err := applySignatureFlags(t,
+		"--request-file", requestFile,
+		"--region", "RegionTwo",
+		"--path", "/other",
+		"--param", "versionId=cli",
+		"--header", "Content-Type=application/json",
+		"--body-hash", "cli-hash",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// CLI flags take precedence over the request file values
+	if ao.Region != "RegionTwo" || ao.Service != "s3" || ao.Verb != "PUT" || ao.Path != "/other" || ao.Host != "s3.example.com" {
+		t.Errorf("unexpected request: %s %s %s %s %s", ao.Region, ao.Service, ao.Verb, ao.Path, ao.Host)
+	}
+	if expected := map[string]string{"acl": "", "versionId": "cli"}; !reflect.DeepEqual(ao.Params, expected) {
+		t.Errorf("unexpected params: %v", ao.Params)
+	}
+	expected := map[string]string{
+		"X-Amz-Date":          "20200101T000000Z",
+		"Content-Type":        "application/json",
+		"Host":                "s3.example.com",
+		"X-Amz-SignedHeaders": "content-type;host;x-amz-date",
+	}
+	if !reflect.DeepEqual(ao.Headers, expected) {
+		t.Errorf("unexpected headers: %v", ao.Headers)
+	}
+	if ao.BodyHash == nil || *ao.BodyHash != "cli-hash" {
+		t.Errorf("unexpected body hash: %v", ao.BodyHash)
+	}
+
+	if _, err := applySignatureFlags(t, "--request-file", writeTempFile(t, "invalid.json", "{")); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
+
+func TestSignatureOptionsSignedHeaders(t *testing.T) {
+	cases := []struct {
+		name     string
+		args     []string
+		expected map[string]string
+	}{
+		{
+			name: "no headers",
+		},
+		{
+			name:     "v4 host",
+			args:     []string{"--request-host", "ec2.example.com"},
+			expected: map[string]string{"Host": "ec2.example.com", signedHeadersKey: "host"},
+		},
+		{
+			name: "v2 host isn't a header",
+			args: []string{"--signature-version", "2", "--request-host", "ec2.example.com"},
+		},
+		{
+			name:     "explicit host header",
+			args:     []string{"--request-host", "ec2.example.com", "--header", "Host=other.example.com", "--header", "X-Amz-Date=20200101T000000Z"},
+			expected: map[string]string{"Host": "other.example.com", "X-Amz-Date": "20200101T000000Z", signedHeadersKey: "host;x-amz-date"},
+		},
+		{
+			name:     "explicit signed headers",
+			args:     []string{"--header", "X-Amz-Date=20200101T000000Z", "--header", "Content-Type=text/plain", "--signed-headers", "x-amz-date"},
+			expected: map[string]string{"Content-Type": "text/plain", "X-Amz-Date": "20200101T000000Z", signedHeadersKey: "x-amz-date"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ao, err := applySignatureFlags(t, c.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ao.Headers, c.expected) {
+				t.Errorf("unexpected headers: %v", ao.Headers)
+			}
+		})
+	}
+}
+
+func TestSignatureOptionsVersion(t *testing.T) {
+	cases := []struct {
+		name   string
+		args   []string
+		params map[string]string
+		err    string
+	}{
+		{
+			name: "v4",
+		},
+		{
+			name:   "v2 default method",
+			args:   []string{"--signature-version", "2", "--param", "Action=DescribeInstances"},
+			params: map[string]string{"Action": "DescribeInstances", "SignatureVersion": "2", "SignatureMethod": ec2tokens.EC2CredentialsHmacSha256V2},
+		},
+		{
+			name:   "v2 sha1",
+			args:   []string{"--signature-version", "2", "--signature-method", ec2tokens.EC2CredentialsHmacSha1V2},
+			params: map[string]string{"SignatureVersion": "2", "SignatureMethod": ec2tokens.EC2CredentialsHmacSha1V2},
+		},
+		{
+			name: "v2 invalid method",
+			args: []string{"--signature-version", "2", "--signature-method", ec2tokens.EC2CredentialsAwsHmacV4},
+			err:  "unsupported signature V2 method",
+		},
+		{
+			name: "v4 invalid method",
+			args: []string{"--signature-method", ec2tokens.EC2CredentialsHmacSha1V2},
+			err:  "unsupported signature V4 method",
+		},
+		{
+			name: "invalid version",
+			args: []string{"--signature-version", "3"},
+			err:  "unsupported signature version",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ao, err := applySignatureFlags(t, c.args...)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected %q error, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ao.Params, c.params) {
+				t.Errorf("unexpected params: %v", ao.Params)
+			}
+		})
+	}
+}
+
+func TestSignatureOptionsBody(t *testing.T) {
+	bodyFile := writeTempFile(t, "body", "hello")
+	// printf hello | sha256sum
+	const bodyHash = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	ao, err := applySignatureFlags(t, "--body-file", bodyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ao.BodyHash == nil || *ao.BodyHash != bodyHash {
+		t.Errorf("unexpected body hash: %v", ao.BodyHash)
+	}
+
+	ao, err = applySignatureFlags(t, "--body-file", writeTempFile(t, "empty", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ao.BodyHash == nil || *ao.BodyHash != pkg.EmptyBodyHash {
+		t.Errorf("unexpected empty body hash: %v", ao.BodyHash)
+	}
+
+	ao, err = applySignatureFlags(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ao.BodyHash != nil {
+		t.Errorf("body hash must not be set by default, got %s", *ao.BodyHash)
+	}
+
+	for _, args := range [][]string{
+		{"--body-file", bodyFile, "--body-hash", bodyHash},
+		{"--body-hash", bodyHash, "--request-file", writeTempFile(t, "request.json", `{"body_file": "`+filepath.ToSlash(bodyFile)+`"}`)},
+	} {
+		if _, err := applySignatureFlags(t, args...); err == nil || !strings.Contains(err.Error(), "cannot be set simultaneously") {
+			t.Errorf("%v: expected a mutually exclusive error, got %v", args, err)
+		}
+	}
+
+	if _, err := applySignatureFlags(t, "--body-file", bodyFile+".missing"); err == nil {
+		t.Errorf("expected an error for a missing body file")
+	}
+}
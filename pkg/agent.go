@@ -0,0 +1,273 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAgentMargin is a default duration before the token expiry,
+	// when the agent refreshes the token
+	DefaultAgentMargin = 5 * time.Minute
+	// DefaultAgentJitter is a default maximum random delay subtracted from
+	// the refresh time, so multiple agents don't refresh simultaneously
+	DefaultAgentJitter = time.Minute
+	// DefaultAgentMinRetry is a default initial delay between failed
+	// refresh attempts
+	DefaultAgentMinRetry = time.Second
+	// DefaultAgentMaxRetry is a default maximum delay between failed refresh
+	// attempts
+	DefaultAgentMaxRetry = time.Minute
+
+	// agentTokenPath is an agent HTTP API path, which returns the token
+	agentTokenPath = "/token"
+)
+
+// Agent keeps a fresh token and refreshes it before it expires
+type Agent struct {
+	// Auth obtains a new token
+	Auth func(ctx context.Context) (*AuthResult, error)
+	// AuthURL and Access identify the Keystone and the EC2 credential used
+	// to obtain the token, they are served with the token, so clients can
+	// check, whether the token is the requested one
+	AuthURL string
+	Access  string
+	// Margin is a duration before the token expiry, when the token is
+	// refreshed, DefaultAgentMargin is used when zero
+	Margin time.Duration
+	// Jitter is a maximum random delay subtracted from the refresh time,
+	// DefaultAgentJitter is used when zero
+	Jitter time.Duration
+	// MinRetry and MaxRetry limit the exponential backoff between failed
+	// refresh attempts, DefaultAgentMinRetry and DefaultAgentMaxRetry are
+	// used when zero
+	MinRetry time.Duration
+	MaxRetry time.Duration
+	// OnRefresh is called after each successful refresh with a delay before
+	// the next refresh, when not nil
+	OnRefresh func(res *AuthResult, next time.Duration)
+	// OnError is called after each failed refresh with a delay before the
+	// next attempt, when not nil
+	OnError func(err error, next time.Duration)
+
+	mu  sync.RWMutex
+	res *AuthResult
+}
+
+// AgentToken represents a token served by an agent
+type AgentToken struct {
+	AuthResult
+	AuthURL string `json:"auth_url"`
+	Access  string `json:"access"`
+}
+
+// Check returns an error, when the token wasn't obtained from the Keystone
+// auth URL using the EC2 access or isn't scoped to the project. Empty values
+// aren't checked.
+func (t *AgentToken) Check(authURL, access, projectID, projectName string) error {
+	switch {
+	case authURL != "" && strings.TrimSuffix(t.AuthURL, "/") != strings.TrimSuffix(authURL, "/"):
+		return fmt.Errorf("agent token was obtained from %q, not from %q", t.AuthURL, authURL)
+	case access != "" && t.Access != access:
+		return fmt.Errorf("agent token was obtained using another EC2 access")
+	case projectID != "" && t.ProjectID != projectID:
+		return fmt.Errorf("agent token is scoped to %q project ID, not to %q", t.ProjectID, projectID)
+	case projectName != "" && t.Project != projectName:
+		return fmt.Errorf("agent token is scoped to %q project, not to %q", t.Project, projectName)
+	}
+	return nil
+}
+
+func durationOrDefault(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
+
+// Token returns the current token, nil is returned, when there is no valid
+// token
+func (a *Agent) Token() *AuthResult {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.res == nil || !time.Now().Before(a.res.ExpiresAt) {
+		return nil
+	}
+	return a.res
+}
+
+// Run obtains and refreshes the token until ctx is done. A token, which is
+// already expired, e.g. due to a clock skew, is treated as a failure. An
+// unauthorized or forbidden error, e.g. a revoked credential, cannot be fixed
+// by retrying, so Run stops and returns the classified error.
+func (a *Agent) Run(ctx context.Context) error {
+	minRetry := durationOrDefault(a.MinRetry, DefaultAgentMinRetry)
+	maxRetry := durationOrDefault(a.MaxRetry, DefaultAgentMaxRetry)
+
+	retry := minRetry
+	for {
+		var delay time.Duration
+		res, err := a.Auth(ctx)
+		if err == nil && !time.Now().Before(res.ExpiresAt) {
+			err = fmt.Errorf("token expired at %s, check the clock skew", res.ExpiresAt)
+		}
+		if err == nil {
+			a.mu.Lock()
+			a.res = res
+			a.mu.Unlock()
+
+			delay = a.refreshDelay(res, minRetry)
+			retry = minRetry
+			if a.OnRefresh != nil {
+				a.OnRefresh(res, delay)
+			}
+		} else {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if e, ok := ClassifyError(err).(*AuthError); ok && (e.Class == ErrUnauthorized || e.Class == ErrForbidden) {
+				return e
+			}
+
+			// exponential backoff with an equal jitter, so attempts
+			// are never closer than the half of minRetry
+			delay = retry/2 + time.Duration(rand.Int63n(int64(retry/2)+1))
+			if a.OnError != nil {
+				a.OnError(err, delay)
+			}
+			if retry *= 2; retry > maxRetry {
+				retry = maxRetry
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// refreshDelay returns a delay before the next refresh. A token is refreshed
+// not earlier than in the half of its remaining lifetime and not earlier
+// than in minDelay, so a short-lived token doesn't cause a refresh loop.
+func (a *Agent) refreshDelay(res *AuthResult, minDelay time.Duration) time.Duration {
+	margin := durationOrDefault(a.Margin, DefaultAgentMargin)
+	jitter := durationOrDefault(a.Jitter, DefaultAgentJitter)
+
+	lifetime := time.Until(res.ExpiresAt)
+	delay := lifetime - margin
+	if jitter > 0 {
+		delay -= time.Duration(rand.Int63n(int64(jitter)))
+	}
+	if delay < lifetime/2 {
+		delay = lifetime / 2
+	}
+	if delay < minDelay {
+		delay = minDelay
+	}
+	return delay
+}
+
+// ServeHTTP implements the http.Handler interface, the current token is
+// returned as a JSON encoded AgentToken
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != agentTokenPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	res := a.Token()
+	if res == nil {
+		http.Error(w, "there is no valid token", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AgentToken{
+		AuthResult: *res,
+		AuthURL:    a.AuthURL,
+		Access:     a.Access,
+	})
+}
+
+// ListenUnix listens on a Unix socket, which is accessible only by the
+// current user. The socket is created with restrictive permissions, so there
+// is no window, when other users can connect. A stale socket file is removed.
+func ListenUnix(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%q socket is already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := listenUnix(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// GetAgentToken returns a token served by an agent on the Unix socket
+func GetAgentToken(ctx context.Context, path string) (*AgentToken, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "http://agent"+agentTokenPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("agent returned %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	var res AgentToken
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("failed to parse the agent response: %v", err)
+	}
+
+	if !time.Now().Before(res.ExpiresAt) {
+		return nil, fmt.Errorf("agent returned an expired token")
+	}
+
+	return &res, nil
+}
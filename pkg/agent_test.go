@@ -0,0 +1,273 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+func TestAgentRefreshDelay(t *testing.T) {
+	cases := []struct {
+		name     string
+		agent    *Agent
+		lifetime time.Duration
+		min, max time.Duration
+	}{
+		{"margin", &Agent{Margin: 5 * time.Minute, Jitter: time.Nanosecond}, time.Hour, 54 * time.Minute, 55 * time.Minute},
+		{"jitter", &Agent{Margin: 5 * time.Minute, Jitter: time.Minute}, time.Hour, 53 * time.Minute, 55 * time.Minute},
+		{"half lifetime", &Agent{}, 2 * time.Minute, 59 * time.Second, time.Minute},
+		{"min delay", &Agent{}, time.Second, 10 * time.Second, 10 * time.Second},
+		{"expired", &Agent{}, -time.Hour, 10 * time.Second, 10 * time.Second},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := &AuthResult{ExpiresAt: time.Now().Add(c.lifetime)}
+			d := c.agent.refreshDelay(res, 10*time.Second)
+			if d < c.min || d > c.max {
+				t.Errorf("expected a delay between %s and %s, got %s", c.min, c.max, d)
+			}
+		})
+	}
+}
+
+func TestAgentRun(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var calls, refreshes int
+	var errs []string
+	var delays []time.Duration
+
+	a := &Agent{
+		Auth: func(ctx context.Context) (*AuthResult, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			switch calls {
+			case 1:
+				return nil, fmt.Errorf("connection refused")
+			case 2:
+				// an already expired token must not be served
+				return &AuthResult{TokenID: "expired", ExpiresAt: time.Now().Add(-time.Second)}, nil
+			}
+			return &AuthResult{TokenID: fmt.Sprintf("token%d", calls), ExpiresAt: time.Now().Add(time.Hour)}, nil
+		},
+		Margin:   time.Nanosecond,
+		Jitter:   time.Nanosecond,
+		MinRetry: 20 * time.Millisecond,
+		MaxRetry: 40 * time.Millisecond,
+		OnRefresh: func(res *AuthResult, next time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			refreshes++
+			delays = append(delays, next)
+			cancel()
+		},
+	}
+	a.OnError = func(err error, next time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		if a.Token() != nil {
+			t.Errorf("token is served after a failure")
+		}
+		if next < 10*time.Millisecond {
+			t.Errorf("retry delay %s is shorter than the half of MinRetry", next)
+		}
+		errs = append(errs, err.Error())
+	}
+
+	if err := a.Run(ctx); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	if calls != 3 || refreshes != 1 || len(errs) != 2 {
+		t.Fatalf("unexpected calls %d, refreshes %d, errors %v", calls, refreshes, errs)
+	}
+	if !strings.Contains(errs[1], "token expired") {
+		t.Errorf("unexpected error: %s", errs[1])
+	}
+	if delays[0] < 59*time.Minute {
+		t.Errorf("unexpected refresh delay: %s", delays[0])
+	}
+	if res := a.Token(); res == nil || res.TokenID != "token3" {
+		t.Errorf("unexpected token: %v", res)
+	}
+}
+
+func TestAgentRunAuthError(t *testing.T) {
+	cases := []struct {
+		name  string
+		err   error
+		class ErrorClass
+	}{
+		{"unauthorized", &AuthError{Class: ErrUnauthorized, StatusCode: http.StatusUnauthorized}, ErrUnauthorized},
+		{"forbidden", gophercloud.ErrDefault403{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusForbidden}}, ErrForbidden},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var calls int
+			a := &Agent{
+				Auth: func(ctx context.Context) (*AuthResult, error) {
+					calls++
+					if calls == 1 {
+						// a short-lived token is refreshed in a half of its lifetime
+						return &AuthResult{TokenID: "token1", ExpiresAt: time.Now().Add(50 * time.Millisecond)}, nil
+					}
+					// the credential was revoked
+					return nil, c.err
+				},
+				Margin:   time.Nanosecond,
+				Jitter:   time.Nanosecond,
+				MinRetry: 10 * time.Millisecond,
+				MaxRetry: 10 * time.Millisecond,
+				OnError: func(err error, next time.Duration) {
+					t.Errorf("an auth error must not be retried: %v", err)
+				},
+			}
+
+			err := a.Run(ctx)
+			e, ok := err.(*AuthError)
+			if !ok || e.Class != c.class {
+				t.Fatalf("expected %s error, got %v", c.class, err)
+			}
+			if calls != 2 {
+				t.Errorf("expected 2 calls, got %d", calls)
+			}
+		})
+	}
+}
+
+func TestAgentServeHTTP(t *testing.T) {
+	a := &Agent{AuthURL: "http://keystone/v3/", Access: "AK1"}
+
+	get := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if w := get(http.MethodGet, "/token"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without a token, got %d", w.Code)
+	}
+
+	a.res = &AuthResult{TokenID: "expired", ExpiresAt: time.Now().Add(-time.Second)}
+	if w := get(http.MethodGet, "/token"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 with an expired token, got %d", w.Code)
+	}
+
+	a.res = &AuthResult{TokenID: "valid", ProjectID: "p1", ExpiresAt: time.Now().Add(time.Hour)}
+	w := get(http.MethodGet, "/token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var tok AgentToken
+	if err := json.Unmarshal(w.Body.Bytes(), &tok); err != nil {
+		t.Fatal(err)
+	}
+	if tok.TokenID != "valid" || tok.ProjectID != "p1" || tok.AuthURL != a.AuthURL || tok.Access != a.Access {
+		t.Errorf("unexpected token: %+v", tok)
+	}
+
+	if w := get(http.MethodPost, "/token"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", w.Code)
+	}
+	if w := get(http.MethodGet, "/"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestAgentTokenCheck(t *testing.T) {
+	tok := &AgentToken{
+		AuthResult: AuthResult{ProjectID: "p1", Project: "demo"},
+		AuthURL:    "http://keystone/v3/",
+		Access:     "AK1",
+	}
+
+	cases := []struct {
+		authURL, access, projectID, projectName string
+		err                                     string
+	}{
+		{"", "", "", "", ""},
+		{"http://keystone/v3", "AK1", "p1", "demo", ""},
+		{"http://other/v3/", "", "", "", "not from"},
+		{"", "AK2", "", "", "another EC2 access"},
+		{"", "", "p2", "", "project ID"},
+		{"", "", "", "other", "project"},
+	}
+
+	for _, c := range cases {
+		err := tok.Check(c.authURL, c.access, c.projectID, c.projectName)
+		if c.err == "" && err != nil || c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%+v: unexpected error: %v", c, err)
+		}
+	}
+}
+
+func TestGetAgentToken(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix sockets may be unavailable")
+	}
+
+	dir, err := ioutil.TempDir("", "ec2auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "agent.sock")
+
+	a := &Agent{
+		AuthURL: "http://keystone/v3/",
+		Access:  "AK1",
+		res:     &AuthResult{TokenID: "valid", ExpiresAt: time.Now().Add(time.Hour)},
+	}
+
+	l, err := ListenUnix(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: a}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	fi, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		t.Errorf("socket is accessible by other users: %o", perm)
+	}
+
+	if _, err := ListenUnix(socket); err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Errorf("expected an already in use error, got %v", err)
+	}
+
+	tok, err := GetAgentToken(context.Background(), socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.TokenID != "valid" || tok.AuthURL != a.AuthURL || tok.Access != a.Access {
+		t.Errorf("unexpected token: %+v", tok)
+	}
+
+	if _, err := GetAgentToken(context.Background(), socket+".missing"); err == nil {
+		t.Errorf("expected an error for a missing socket")
+	}
+}
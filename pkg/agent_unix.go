@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package pkg
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenUnix creates a Unix socket under a restrictive umask, which is
+// process wide, so files created concurrently get the same umask
+func listenUnix(path string) (net.Listener, error) {
+	old := syscall.Umask(0077)
+	defer syscall.Umask(old)
+
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package pkg
+
+import (
+	"net"
+)
+
+// listenUnix creates a Unix socket, Windows doesn't support umask, the
+// socket is protected by the parent directory ACL
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,299 @@
+package pkg
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+)
+
+// DefaultCacheMargin is a default safety margin before the token expiry,
+// when a cached token is not reused anymore
+const DefaultCacheMargin = 5 * time.Minute
+
+// TokenCache is an on-disk token cache keyed by an auth URL and an EC2 access
+// ID
+type TokenCache struct {
+	// Dir is a directory, where cached tokens are stored
+	Dir string
+	// Margin is a safety margin before the token expiry
+	Margin time.Duration
+	// If Logger is not nil, then cache hits and misses are logged
+	Logger ILogger
+}
+
+// DefaultCacheDir returns a default cache directory, e.g.
+// $XDG_CACHE_HOME/ec2auth
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ec2auth"), nil
+}
+
+// NewTokenCache returns a token cache, stored in a dir. An empty dir means
+// the DefaultCacheDir.
+func NewTokenCache(dir string, margin time.Duration) (*TokenCache, error) {
+	if dir == "" {
+		var err error
+		dir, err = DefaultCacheDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &TokenCache{
+		Dir:    dir,
+		Margin: margin,
+	}, nil
+}
+
+func (c *TokenCache) path(authURL, access string) string {
+	h := sha256.Sum256([]byte(authURL + "\x00" + access))
+	return filepath.Join(c.Dir, hex.EncodeToString(h[:])+".json")
+}
+
+func (c *TokenCache) log() ILogger {
+	if c.Logger == nil {
+		return &NoopLogger{}
+	}
+	return c.Logger
+}
+
+// Lock acquires an exclusive lock for a cache entry. The returned function
+// releases the lock.
+func (c *TokenCache) Lock(authURL, access string) (func(), error) {
+	err := os.MkdirAll(c.Dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return lockFile(c.path(authURL, access) + ".lock")
+}
+
+// cacheEntry is a cached token with a verifier of the secret used to obtain
+// it
+type cacheEntry struct {
+	AuthResult
+	// Verifier is an HMAC-SHA256 of the auth URL and the access keyed by the
+	// secret, so a token isn't returned for a wrong secret
+	Verifier string `json:"verifier,omitempty"`
+}
+
+// cacheVerifier returns a cache entry verifier for the secret
+func cacheVerifier(authURL, access, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(authURL + "\x00" + access))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// get returns a cache entry, when its token is still valid
+func (c *TokenCache) get(authURL, access string) (*cacheEntry, error) {
+	data, err := ioutil.ReadFile(c.path(authURL, access))
+	if os.IsNotExist(err) {
+		c.log().RequestPrintf("Token cache miss")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var e cacheEntry
+	err = json.Unmarshal(data, &e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the cached token: %v", err)
+	}
+
+	if time.Until(e.ExpiresAt) <= c.Margin {
+		c.log().RequestPrintf("Cached token expires at %s, ignoring", e.ExpiresAt)
+		return nil, nil
+	}
+
+	return &e, nil
+}
+
+// Get returns a cached token, when it is still valid. A nil result is
+// returned, when there is no valid token in the cache. The secret is not
+// verified, so Get must not be used instead of the authentication, use
+// GetVerified instead.
+func (c *TokenCache) Get(authURL, access string) (*AuthResult, error) {
+	e, err := c.get(authURL, access)
+	if e == nil {
+		return nil, err
+	}
+
+	c.log().RequestPrintf("Using a cached token, which expires at %s", e.ExpiresAt)
+
+	return &e.AuthResult, nil
+}
+
+// GetVerified is like Get, but the token is returned only, when it was
+// obtained using the same secret
+func (c *TokenCache) GetVerified(authURL, access, secret string) (*AuthResult, error) {
+	e, err := c.get(authURL, access)
+	if e == nil {
+		return nil, err
+	}
+
+	if !hmac.Equal([]byte(e.Verifier), []byte(cacheVerifier(authURL, access, secret))) {
+		c.log().RequestPrintf("Cached token was obtained using another secret, ignoring")
+		return nil, nil
+	}
+
+	c.log().RequestPrintf("Using a cached token, which expires at %s", e.ExpiresAt)
+
+	return &e.AuthResult, nil
+}
+
+// Put stores the token obtained using the secret in the cache
+func (c *TokenCache) Put(authURL, access, secret string, res *AuthResult) error {
+	data, err := json.Marshal(cacheEntry{
+		AuthResult: *res,
+		Verifier:   cacheVerifier(authURL, access, secret),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(c.Dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(c.path(authURL, access), data, 0600)
+}
+
+// Delete removes the token from the cache
+func (c *TokenCache) Delete(authURL, access string) error {
+	err := os.Remove(c.path(authURL, access))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// DeleteToken removes all cache entries, which contain the token, e.g. after
+// the token is revoked. The amount of removed entries is returned.
+func (c *TokenCache) DeleteToken(tokenID string) (int, error) {
+	files, err := filepath.Glob(filepath.Join(c.Dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, path := range files {
+		ok, err := c.deleteTokenFile(path, tokenID)
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// deleteTokenFile removes a cache entry, when it contains the token
+func (c *TokenCache) deleteTokenFile(path, tokenID string) (bool, error) {
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var res AuthResult
+	if err := json.Unmarshal(data, &res); err != nil || res.TokenID != tokenID {
+		return false, nil
+	}
+
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// OpenStackEC2AuthCached returns a cached token, when it is still valid and
+// was obtained using the same secret, otherwise it authenticates and stores a
+// new token in the cache. Concurrent calls for the same access ID are
+// serialized using a file lock. A failure to store the token is logged, but
+// the token is still returned.
+func OpenStackEC2AuthCached(identityClient *gophercloud.ServiceClient, ao *ec2tokens.AuthOptions, cache *TokenCache) (*AuthResult, error) {
+	authURL := identityClient.IdentityEndpoint
+
+	unlock, err := cache.Lock(authURL, ao.Access)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock the token cache: %v", err)
+	}
+	defer unlock()
+
+	res, err := cache.GetVerified(authURL, ao.Access, ao.Secret)
+	if err != nil {
+		cache.log().RequestPrintf("%s", err)
+	}
+	if res != nil {
+		return res, nil
+	}
+
+	res, err = OpenStackEC2Auth(identityClient, ao)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cache.Put(authURL, ao.Access, ao.Secret, res)
+	if err != nil {
+		log.Printf("WARNING: failed to store the token in the cache: %v", err)
+	}
+
+	return res, nil
+}
+
+// OpenStackEC2AuthCachedWithContext is like OpenStackEC2AuthCached, but the
+// request is canceled, when ctx is done
+func OpenStackEC2AuthCachedWithContext(ctx context.Context, identityClient *gophercloud.ServiceClient, ao *ec2tokens.AuthOptions, cache *TokenCache) (*AuthResult, error) {
+	return OpenStackEC2AuthCached(WithContext(ctx, identityClient), ao, cache)
+}
+
+// WriteFileAtomic writes data to a temporary file and renames it to the
+// target path
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err = f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,137 @@
+package pkg_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+	"github.com/kayrus/ec2auth/pkg"
+	"github.com/kayrus/ec2auth/pkg/fake"
+)
+
+// newTokenCache returns a token cache in a temporary directory, which is
+// removed, when the test finishes
+func newTokenCache(t *testing.T) *pkg.TokenCache {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "ec2auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	cache, err := pkg.NewTokenCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestOpenStackEC2AuthCached(t *testing.T) {
+	client, _ := newFakeKeystone(t, fake.Options{})
+	cache := newTokenCache(t)
+
+	auth := func(secret string) (*pkg.AuthResult, error) {
+		return pkg.OpenStackEC2AuthCached(client, &ec2tokens.AuthOptions{Access: testAccess, Secret: secret}, cache)
+	}
+
+	res, err := auth(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := auth(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.TokenID != res.TokenID {
+		t.Errorf("expected the cached token %q, got %q", res.TokenID, cached.TokenID)
+	}
+
+	// the cached token must not be returned for a wrong secret
+	_, err = auth("wrong")
+	var authErr *pkg.AuthError
+	if !errors.As(err, &authErr) || authErr.Class != pkg.ErrUnauthorized {
+		t.Fatalf("expected an unauthorized error, got %v", err)
+	}
+
+	// the unverified lookup still finds the token, e.g. for inspection
+	got, err := cache.Get(client.IdentityEndpoint, testAccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.TokenID != res.TokenID {
+		t.Errorf("unexpected cache entry: %v", got)
+	}
+}
+
+func TestOpenStackEC2AuthCachedPutFailure(t *testing.T) {
+	client, _ := newFakeKeystone(t, fake.Options{})
+	cache := newTokenCache(t)
+	ao := &ec2tokens.AuthOptions{Access: testAccess, Secret: testSecret}
+
+	if _, err := pkg.OpenStackEC2AuthCached(client, ao, cache); err != nil {
+		t.Fatal(err)
+	}
+
+	// a directory in place of the cache entry can be neither read nor
+	// replaced
+	files, err := filepath.Glob(filepath.Join(cache.Dir, "*.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected a single cache entry, got %v: %v", files, err)
+	}
+	if err := os.Remove(files[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(files[0], 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := pkg.OpenStackEC2AuthCached(client, ao, cache)
+	if err != nil {
+		t.Fatalf("a cache failure must not fail the authentication: %v", err)
+	}
+	if res.TokenID == "" {
+		t.Errorf("empty token ID")
+	}
+}
+
+func TestTokenCacheDeleteToken(t *testing.T) {
+	cache := newTokenCache(t)
+
+	expiresAt := time.Now().Add(time.Hour)
+	entries := []struct {
+		authURL, access, token string
+	}{
+		{"https://a/v3", "ak1", "revoked"},
+		{"https://b/v3", "ak1", "revoked"},
+		{"https://a/v3", "ak2", "valid"},
+	}
+	for _, v := range entries {
+		if err := cache.Put(v.authURL, v.access, "secret", &pkg.AuthResult{TokenID: v.token, ExpiresAt: expiresAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := cache.DeleteToken("revoked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 deleted entries, got %d", n)
+	}
+
+	for _, v := range entries {
+		res, err := cache.Get(v.authURL, v.access)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted := res == nil; deleted != (v.token == "revoked") {
+			t.Errorf("%s %s: unexpected cache entry %v", v.authURL, v.access, res)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package pkg
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+// EndpointURL returns an endpoint URL from the token service catalog. When
+// multiple endpoints match, the first one is returned.
+func (r *AuthResult) EndpointURL(opts gophercloud.EndpointOpts) (string, error) {
+	switch opts.Availability {
+	case "":
+		opts.Availability = gophercloud.AvailabilityPublic
+	case gophercloud.AvailabilityPublic, gophercloud.AvailabilityInternal, gophercloud.AvailabilityAdmin:
+	default:
+		return "", fmt.Errorf("unsupported interface %q, supported interfaces: public, internal, admin", opts.Availability)
+	}
+
+	url, err := openstack.V3EndpointURL(&tokens.ServiceCatalog{Entries: r.Catalog}, opts)
+	if _, ok := err.(*gophercloud.ErrEndpointNotFound); ok {
+		s := fmt.Sprintf("no %s %q endpoint found in the service catalog", opts.Availability, opts.Type)
+		if opts.Name != "" {
+			s += fmt.Sprintf(", service name %q", opts.Name)
+		}
+		if opts.Region != "" {
+			s += fmt.Sprintf(", region %q", opts.Region)
+		}
+		return "", fmt.Errorf("%s", s)
+	}
+
+	return url, err
+}
@@ -0,0 +1,79 @@
+package pkg_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+// testCatalog contains endpoints identified either by a region name or by a
+// region ID only
+var testCatalog = []tokens.CatalogEntry{
+	{
+		Type: "object-store",
+		Name: "swift",
+		Endpoints: []tokens.Endpoint{
+			{Interface: "public", Region: "RegionOne", RegionID: "RegionOne", URL: "https://swift.one.example.com/v1/AUTH_p1"},
+			{Interface: "internal", Region: "RegionOne", RegionID: "RegionOne", URL: "http://swift.one.internal/v1/AUTH_p1"},
+			{Interface: "public", RegionID: "region-two", URL: "https://swift.two.example.com/v1/AUTH_p1"},
+		},
+	},
+	{
+		Type: "object-store",
+		Name: "ceph",
+		Endpoints: []tokens.Endpoint{
+			{Interface: "public", Region: "RegionOne", URL: "https://ceph.one.example.com/swift/v1/"},
+		},
+	},
+	{
+		Type: "compute",
+		Name: "nova",
+		Endpoints: []tokens.Endpoint{
+			{Interface: "admin", Region: "RegionOne", URL: "http://nova.one.internal/v2.1"},
+		},
+	},
+}
+
+func TestEndpointURL(t *testing.T) {
+	res := &pkg.AuthResult{Catalog: testCatalog}
+
+	cases := []struct {
+		name     string
+		opts     gophercloud.EndpointOpts
+		expected string
+		err      string
+	}{
+		{"public by default", gophercloud.EndpointOpts{Type: "object-store"}, "https://swift.one.example.com/v1/AUTH_p1/", ""},
+		{"interface", gophercloud.EndpointOpts{Type: "object-store", Availability: gophercloud.AvailabilityInternal}, "http://swift.one.internal/v1/AUTH_p1/", ""},
+		{"service name", gophercloud.EndpointOpts{Type: "object-store", Name: "ceph"}, "https://ceph.one.example.com/swift/v1/", ""},
+		{"region", gophercloud.EndpointOpts{Type: "object-store", Region: "RegionOne"}, "https://swift.one.example.com/v1/AUTH_p1/", ""},
+		{"region id", gophercloud.EndpointOpts{Type: "object-store", Region: "region-two"}, "https://swift.two.example.com/v1/AUTH_p1/", ""},
+		{"admin", gophercloud.EndpointOpts{Type: "compute", Availability: gophercloud.AvailabilityAdmin}, "http://nova.one.internal/v2.1/", ""},
+		{"no public", gophercloud.EndpointOpts{Type: "compute"}, "", `no public "compute" endpoint found`},
+		{"no region", gophercloud.EndpointOpts{Type: "object-store", Name: "ceph", Region: "region-two"}, "", `no public "object-store" endpoint found in the service catalog, service name "ceph", region "region-two"`},
+		{"no type", gophercloud.EndpointOpts{Type: "volumev3"}, "", `no public "volumev3" endpoint found`},
+		{"invalid interface", gophercloud.EndpointOpts{Type: "object-store", Availability: "private"}, "", `unsupported interface "private"`},
+		{"invalid interface and no type", gophercloud.EndpointOpts{Type: "volumev3", Availability: "private"}, "", `unsupported interface "private"`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			url, err := res.EndpointURL(c.opts)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected %q error, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if url != c.expected {
+				t.Errorf("expected %s, got %s", c.expected, url)
+			}
+		})
+	}
+}
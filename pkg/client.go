@@ -7,9 +7,12 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // ILogger is an interface representing the Logger struct
@@ -55,13 +58,30 @@ type RoundTripper struct {
 	maskHeaders *map[string]struct{}
 	// A custom function to format and mask JSON requests and responses
 	FormatJSON func([]byte) (string, error)
-	// How many times HTTP connection should be retried until giving up
+	// How many times HTTP request should be retried on connection errors,
+	// 5xx and 429 responses until giving up
 	MaxRetries int
+	// RetryBackoff is a base exponential backoff delay between retries,
+	// DefaultRetryBackoff is used when zero
+	RetryBackoff time.Duration
+	// MaxRetryBackoff is a maximum delay between retries,
+	// DefaultMaxRetryBackoff is used when zero
+	MaxRetryBackoff time.Duration
+	// RetryBudget is a maximum overall time spent on retries including
+	// delays, zero means unlimited
+	RetryBudget time.Duration
 	// If Logger is not nil, then RoundTrip method will debug the JSON
 	// requests and responses
 	Logger ILogger
 }
 
+const (
+	// DefaultRetryBackoff is a default base delay between retries
+	DefaultRetryBackoff = 100 * time.Millisecond
+	// DefaultMaxRetryBackoff is a default maximum delay between retries
+	DefaultMaxRetryBackoff = 10 * time.Second
+)
+
 // List of headers that contain sensitive data.
 var defaultSensitiveHeaders = map[string]struct{}{
 	"x-auth-token":                    {},
@@ -197,22 +217,68 @@ func (rt *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 	}
 	response, err := ort.RoundTrip(request)
 
-	// If the first request didn't return a response, retry up to `max_retries`.
-	retry := 1
-	for rt.MaxRetries > 0 && response == nil {
+	// retry connection errors, 5xx and 429 responses up to `max_retries`
+	start := time.Now()
+	for retry := 1; rt.MaxRetries > 0 && shouldRetry(response, err); retry++ {
 		if retry > rt.MaxRetries {
 			if rt.Logger != nil {
-				rt.log().ResponsePrintf("Connection error, retries exhausted. Aborting")
+				rt.log().ResponsePrintf("Retries exhausted. Aborting")
 			}
-			err = fmt.Errorf("Connection error, retries exhausted. Aborting. Last error was: %s", err)
-			return nil, err
+			if err != nil {
+				err = fmt.Errorf("Connection error, retries exhausted. Aborting. Last error was: %w", err)
+			}
+			break
+		}
+
+		delay := rt.retryDelay(retry, response)
+		if rt.RetryBudget > 0 && time.Since(start)+delay > rt.RetryBudget {
+			if rt.Logger != nil {
+				rt.log().ResponsePrintf("Retry budget %s exhausted. Aborting", rt.RetryBudget)
+			}
+			if err != nil {
+				err = fmt.Errorf("Connection error, retry budget exhausted. Aborting. Last error was: %w", err)
+			}
+			break
+		}
+
+		// the request body was consumed by the previous attempt
+		req := request
+		if request.Body != nil && request.Body != http.NoBody {
+			if request.GetBody == nil {
+				if rt.Logger != nil {
+					rt.log().ResponsePrintf("Cannot retry a request with a non-replayable body")
+				}
+				break
+			}
+			body, bodyErr := request.GetBody()
+			if bodyErr != nil {
+				return nil, bodyErr
+			}
+			req = request.Clone(request.Context())
+			req.Body = body
 		}
 
 		if rt.Logger != nil {
-			rt.log().ResponsePrintf("Connection error, retry number %d: %s", retry, err)
+			if err != nil {
+				rt.log().ResponsePrintf("Connection error, retry number %d in %s: %s", retry, delay, err)
+			} else {
+				rt.log().ResponsePrintf("Code %d, retry number %d in %s", response.StatusCode, retry, delay)
+			}
+		}
+
+		if response != nil {
+			// drain the body to reuse the connection
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
 		}
-		response, err = ort.RoundTrip(request)
-		retry += 1
+
+		select {
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		case <-time.After(delay):
+		}
+
+		response, err = ort.RoundTrip(req)
 	}
 
 	if rt.Logger != nil && response != nil {
@@ -278,6 +344,64 @@ func (rt *RoundTripper) logResponse(original io.ReadCloser, contentType string)
 	return original, nil
 }
 
+// shouldRetry returns true on connection errors, 5xx and 429 responses
+func shouldRetry(response *http.Response, err error) bool {
+	if response == nil {
+		return err != nil
+	}
+	return response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+}
+
+// retryDelay returns a delay before the next retry. The Retry-After response
+// header is honored, otherwise an exponential backoff with a full jitter is
+// used.
+func (rt *RoundTripper) retryDelay(retry int, response *http.Response) time.Duration {
+	maxBackoff := rt.MaxRetryBackoff
+	if maxBackoff == 0 {
+		maxBackoff = DefaultMaxRetryBackoff
+	}
+
+	if response != nil {
+		if d, ok := parseRetryAfter(response.Header.Get("Retry-After")); ok {
+			if d > maxBackoff {
+				return maxBackoff
+			}
+			return d
+		}
+	}
+
+	backoff := rt.RetryBackoff
+	if backoff == 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	d := backoff << uint(retry-1)
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// parseRetryAfter parses the Retry-After header value, which is either an
+// amount of seconds or an HTTP date
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
 func (rt *RoundTripper) formatJSON() func([]byte) (string, error) {
 	// this is concurrency safe
 	f := rt.FormatJSON
@@ -342,7 +466,7 @@ func FormatJSON(raw []byte) (string, error) {
 		}
 	}
 
-	// Mask EC2 access id and body hash
+	// Mask EC2 access id, secret and body hash
 	if v, ok := data["credentials"].(map[string]interface{}); ok {
 		var access string
 		if s, ok := v["access"]; ok {
@@ -352,6 +476,9 @@ func FormatJSON(raw []byte) (string, error) {
 		if _, ok := v["body_hash"]; ok {
 			v["body_hash"] = "***"
 		}
+		if _, ok := v["secret"]; ok {
+			v["secret"] = "***"
+		}
 		if v, ok := v["headers"].(map[string]interface{}); ok {
 			if _, ok := v["Authorization"]; ok {
 				if s, ok := v["Authorization"].(string); ok {
@@ -361,6 +488,22 @@ func FormatJSON(raw []byte) (string, error) {
 		}
 	}
 
+	// Mask OS-EC2 credential secrets
+	if v, ok := data["credential"].(map[string]interface{}); ok {
+		if _, ok := v["secret"]; ok {
+			v["secret"] = "***"
+		}
+	}
+	if v, ok := data["credentials"].([]interface{}); ok {
+		for _, v := range v {
+			if v, ok := v.(map[string]interface{}); ok {
+				if _, ok := v["secret"]; ok {
+					v["secret"] = "***"
+				}
+			}
+		}
+	}
+
 	// Ignore the huge catalog output
 	if v, ok := data["token"].(map[string]interface{}); ok {
 		if _, ok := v["catalog"]; ok {
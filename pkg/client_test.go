@@ -0,0 +1,230 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// retryServer responds with the statuses in order and repeats the last one
+type retryServer struct {
+	mu       sync.Mutex
+	statuses []int
+	header   http.Header
+	bodies   []string
+}
+
+func (s *retryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	s.bodies = append(s.bodies, string(body))
+
+	status := s.statuses[len(s.statuses)-1]
+	if i := len(s.bodies) - 1; i < len(s.statuses) {
+		status = s.statuses[i]
+	}
+	for k, v := range s.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(status)
+}
+
+func (s *retryServer) calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.bodies)
+}
+
+// do sends a request through the RoundTripper to the server
+func (s *retryServer) do(t *testing.T, rt *RoundTripper, method string, body io.Reader) *http.Response {
+	t.Helper()
+
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	req, err := http.NewRequest(method, srv.URL+"/v3/ec2tokens", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt.Rt = srv.Client().Transport
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp
+}
+
+func TestRoundTripRetry(t *testing.T) {
+	body := []byte(`{"auth": "\x00binary\xff"}`)
+
+	cases := []struct {
+		name     string
+		method   string
+		body     func() io.Reader
+		statuses []int
+		status   int
+		calls    int
+	}{
+		{"503 then 200", http.MethodPost, func() io.Reader { return bytes.NewReader(body) }, []int{503, 503, 200}, 200, 3},
+		{"429", http.MethodGet, nil, []int{429, 200}, 200, 2},
+		{"exhausted", http.MethodGet, nil, []int{500}, 500, 4},
+		{"404", http.MethodGet, nil, []int{404, 200}, 404, 1},
+		{"401", http.MethodPost, func() io.Reader { return bytes.NewReader(body) }, []int{401, 200}, 401, 1},
+		// a custom reader doesn't provide GetBody
+		{"non-replayable body", http.MethodPost, func() io.Reader { return ioutil.NopCloser(bytes.NewReader(body)) }, []int{503, 200}, 503, 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := &retryServer{statuses: c.statuses, header: http.Header{"Retry-After": {"0"}}}
+			var r io.Reader
+			if c.body != nil {
+				r = c.body()
+			}
+			resp := s.do(t, &RoundTripper{MaxRetries: 3}, c.method, r)
+
+			if resp.StatusCode != c.status || s.calls() != c.calls {
+				t.Errorf("expected %d after %d calls, got %d after %d", c.status, c.calls, resp.StatusCode, s.calls())
+			}
+			if c.body == nil {
+				return
+			}
+			// every attempt must send the same body
+			for i, v := range s.bodies {
+				if v != string(body) {
+					t.Errorf("call %d: unexpected body %q", i+1, v)
+				}
+			}
+		})
+	}
+}
+
+func TestRoundTripRetryBudget(t *testing.T) {
+	cases := []struct {
+		name   string
+		budget time.Duration
+		calls  int
+	}{
+		{"unlimited", 0, 4},
+		{"no retries", 10 * time.Millisecond, 1},
+		{"single retry", 75 * time.Millisecond, 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// Retry-After is capped to a fixed 50ms delay
+			s := &retryServer{statuses: []int{503}, header: http.Header{"Retry-After": {"1"}}}
+			rt := &RoundTripper{
+				MaxRetries:      3,
+				MaxRetryBackoff: 50 * time.Millisecond,
+				RetryBudget:     c.budget,
+			}
+
+			start := time.Now()
+			resp := s.do(t, rt, http.MethodGet, nil)
+			if resp.StatusCode != 503 || s.calls() != c.calls {
+				t.Errorf("expected 503 after %d calls, got %d after %d", c.calls, resp.StatusCode, s.calls())
+			}
+			if c.budget > 0 && time.Since(start) > c.budget {
+				t.Errorf("retries took %s, which exceeds the %s budget", time.Since(start), c.budget)
+			}
+		})
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	for _, c := range []struct {
+		status   int
+		err      error
+		expected bool
+	}{
+		{0, fmt.Errorf("connection refused"), true},
+		{0, nil, false},
+		{200, nil, false},
+		{400, nil, false},
+		{401, nil, false},
+		{403, nil, false},
+		{404, nil, false},
+		{429, nil, true},
+		{500, nil, true},
+		{503, nil, true},
+	} {
+		var resp *http.Response
+		if c.status != 0 {
+			resp = &http.Response{StatusCode: c.status}
+		}
+		if got := shouldRetry(resp, c.err); got != c.expected {
+			t.Errorf("%d %v: expected %t, got %t", c.status, c.err, c.expected, got)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	rt := &RoundTripper{RetryBackoff: 100 * time.Millisecond, MaxRetryBackoff: 10 * time.Second}
+	retryAfter := func(v string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": {v}}}
+	}
+
+	cases := []struct {
+		name     string
+		retry    int
+		response *http.Response
+		min, max time.Duration
+	}{
+		{"backoff", 1, nil, 0, 100 * time.Millisecond},
+		{"exponential backoff", 4, nil, 0, 800 * time.Millisecond},
+		{"max backoff", 20, nil, 0, 10 * time.Second},
+		{"overflow", 100, nil, 0, 10 * time.Second},
+		{"seconds", 1, retryAfter("3"), 3 * time.Second, 3 * time.Second},
+		{"capped seconds", 1, retryAfter("120"), 10 * time.Second, 10 * time.Second},
+		{"date", 1, retryAfter(time.Now().Add(5 * time.Second).UTC().Format(http.TimeFormat)), 3 * time.Second, 5 * time.Second},
+		{"capped date", 1, retryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)), 10 * time.Second, 10 * time.Second},
+		{"past date", 1, retryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)), 0, 0},
+		{"invalid", 1, retryAfter("soon"), 0, 100 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if d := rt.retryDelay(c.retry, c.response); d < c.min || d > c.max {
+					t.Fatalf("expected a delay between %s and %s, got %s", c.min, c.max, d)
+				}
+			}
+		})
+	}
+
+	if d := (&RoundTripper{}).retryDelay(1, retryAfter("60")); d != DefaultMaxRetryBackoff {
+		t.Errorf("expected the default %s cap, got %s", DefaultMaxRetryBackoff, d)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"30", 30 * time.Second, true},
+		{"-1", 0, false},
+		{"1.5", 0, false},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+	} {
+		d, ok := parseRetryAfter(c.value)
+		if d != c.expected || ok != c.ok {
+			t.Errorf("%q: expected %s %t, got %s %t", c.value, c.expected, c.ok, d, ok)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Cloud represents clouds.yaml cloud settings used for EC2 authentication
+type Cloud struct {
+	Name    string
+	AuthURL string
+	// Access and Secret are read from the cloud "auth" section
+	Access string
+	Secret string
+	// ProjectID and ProjectName are read from the cloud "auth" section,
+	// they are used to check a token served by an agent
+	ProjectID   string
+	ProjectName string
+	CACert      string
+	// Verify is nil, when TLS verification is not configured
+	Verify     *bool
+	RegionName string
+}
+
+// cloudsConfigFiles returns clouds.yaml or secure.yaml lookup paths in the
+// openstacksdk order
+func cloudsConfigFiles(env, name string) []string {
+	if v := os.Getenv(env); v != "" {
+		return []string{v}
+	}
+
+	files := []string{name}
+	if dir, err := os.UserConfigDir(); err == nil {
+		files = append(files, filepath.Join(dir, "openstack", name))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".config", "openstack", name))
+	}
+	return append(files, filepath.Join("/etc", "openstack", name))
+}
+
+// readCloudsConfig parses the first existing file, nil is returned, when
+// there are no files
+func readCloudsConfig(files []string) (map[string]interface{}, string, error) {
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, f, err
+		}
+		v, err := parseYAML(string(data))
+		if err != nil {
+			return nil, f, fmt.Errorf("failed to parse %q: %v", f, err)
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, f, fmt.Errorf("failed to parse %q: expected a mapping", f)
+		}
+		return m, f, nil
+	}
+	return nil, "", nil
+}
+
+// mergeMaps merges src into dst recursively, src values take precedence
+func mergeMaps(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if s, ok := v.(map[string]interface{}); ok {
+			if d, ok := dst[k].(map[string]interface{}); ok {
+				mergeMaps(d, s)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// LoadCloud reads the cloud settings from clouds.yaml merged with
+// secure.yaml. The files are looked up in the OS_CLIENT_CONFIG_FILE and
+// OS_CLIENT_SECURE_FILE environment variables, the current directory,
+// ~/.config/openstack and /etc/openstack.
+func LoadCloud(name string) (*Cloud, error) {
+	clouds, path, err := readCloudsConfig(cloudsConfigFiles("OS_CLIENT_CONFIG_FILE", "clouds.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	if clouds == nil {
+		return nil, fmt.Errorf("clouds.yaml not found")
+	}
+
+	secure, _, err := readCloudsConfig(cloudsConfigFiles("OS_CLIENT_SECURE_FILE", "secure.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	if secure != nil {
+		mergeMaps(clouds, secure)
+	}
+
+	all, _ := clouds["clouds"].(map[string]interface{})
+	cfg, ok := all[name].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cloud %q not found in %q", name, path)
+	}
+
+	str := func(m map[string]interface{}, k string) string {
+		s, _ := m[k].(string)
+		return s
+	}
+
+	auth, _ := cfg["auth"].(map[string]interface{})
+	cloud := &Cloud{
+		Name:        name,
+		AuthURL:     str(auth, "auth_url"),
+		Access:      str(auth, "access"),
+		Secret:      str(auth, "secret"),
+		ProjectID:   str(auth, "project_id"),
+		ProjectName: str(auth, "project_name"),
+		CACert:      str(cfg, "cacert"),
+		RegionName:  str(cfg, "region_name"),
+	}
+
+	if v, ok := cfg["verify"].(string); ok {
+		switch strings.ToLower(v) {
+		case "true", "yes", "on":
+			t := true
+			cloud.Verify = &t
+		case "false", "no", "off":
+			f := false
+			cloud.Verify = &f
+		default:
+			return nil, fmt.Errorf("cloud %q: invalid verify value %q", name, v)
+		}
+	}
+
+	return cloud, nil
+}
+
+// CloudProvider returns EC2 credentials from the cloud "auth" section
+type CloudProvider struct {
+	Cloud *Cloud
+}
+
+// Retrieve implements the CredentialProvider interface
+func (p *CloudProvider) Retrieve() (*Credentials, error) {
+	if p.Cloud == nil || p.Cloud.Access == "" {
+		return nil, nil
+	}
+	return &Credentials{
+		Access: p.Cloud.Access,
+		Secret: p.Cloud.Secret,
+		Source: fmt.Sprintf("%q cloud in clouds.yaml", p.Cloud.Name),
+	}, nil
+}
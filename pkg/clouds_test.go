@@ -0,0 +1,70 @@
+package pkg_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+func TestLoadCloud(t *testing.T) {
+	setenv(t, "OS_CLIENT_CONFIG_FILE", writeTempFile(t, "clouds.yaml", `
+clouds:
+  mycloud:
+    auth:
+      auth_url: https://keystone.example.com/v3
+      access: 7522162ced8f4e3eb9502168ef199584
+      secret: overridden
+      project_name: demo
+    cacert: /etc/ssl/certs/ca.pem
+    region_name: RegionOne
+  insecure:
+    auth:
+      auth_url: https://keystone.example.com/v3
+    verify: false
+`))
+	setenv(t, "OS_CLIENT_SECURE_FILE", writeTempFile(t, "secure.yaml", `
+clouds:
+  mycloud:
+    auth:
+      secret: c558d9401a6943bbbb77a83ce910e5a5 # from secure.yaml
+`))
+
+	verify := false
+	cases := []struct {
+		name     string
+		expected *pkg.Cloud
+	}{
+		{"mycloud", &pkg.Cloud{
+			Name:        "mycloud",
+			AuthURL:     "https://keystone.example.com/v3",
+			Access:      "7522162ced8f4e3eb9502168ef199584",
+			Secret:      "c558d9401a6943bbbb77a83ce910e5a5",
+			ProjectName: "demo",
+			CACert:      "/etc/ssl/certs/ca.pem",
+			RegionName:  "RegionOne",
+		}},
+		{"insecure", &pkg.Cloud{
+			Name:    "insecure",
+			AuthURL: "https://keystone.example.com/v3",
+			Verify:  &verify,
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cloud, err := pkg.LoadCloud(c.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cloud, c.expected) {
+				t.Errorf("unexpected cloud: %+v", cloud)
+			}
+		})
+	}
+
+	if _, err := pkg.LoadCloud("missing"); err == nil || !strings.Contains(err.Error(), `cloud "missing" not found`) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
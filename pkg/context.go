@@ -0,0 +1,20 @@
+package pkg
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// WithContext returns a shallow copy of the service client, which passes ctx
+// to HTTP requests. The original client is not modified, so it can be shared
+// between concurrent calls with different deadlines.
+func WithContext(ctx context.Context, client *gophercloud.ServiceClient) *gophercloud.ServiceClient {
+	pc := *client.ProviderClient
+	pc.Context = ctx
+
+	sc := *client
+	sc.ProviderClient = &pc
+
+	return &sc
+}
@@ -0,0 +1,265 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// Credentials represents EC2 credentials and their source
+type Credentials struct {
+	Access string
+	Secret string
+	// Source is a human readable credentials source, e.g. "environment"
+	Source string
+}
+
+// CredentialProvider retrieves EC2 credentials. Nil credentials are
+// returned, when the provider has no credentials.
+type CredentialProvider interface {
+	Retrieve() (*Credentials, error)
+}
+
+// StaticProvider returns credentials defined by the caller, e.g. CLI flags
+type StaticProvider struct {
+	Credentials
+}
+
+// Retrieve implements the CredentialProvider interface
+func (p *StaticProvider) Retrieve() (*Credentials, error) {
+	if p.Access == "" {
+		return nil, nil
+	}
+	c := p.Credentials
+	return &c, nil
+}
+
+// EnvProvider returns credentials from environment variables
+type EnvProvider struct {
+	AccessVar string
+	SecretVar string
+}
+
+// Retrieve implements the CredentialProvider interface
+func (p *EnvProvider) Retrieve() (*Credentials, error) {
+	access := os.Getenv(p.AccessVar)
+	if access == "" {
+		return nil, nil
+	}
+	return &Credentials{
+		Access: access,
+		Secret: os.Getenv(p.SecretVar),
+		Source: fmt.Sprintf("%s and %s environment variables", p.AccessVar, p.SecretVar),
+	}, nil
+}
+
+// SharedConfigProvider returns credentials of an AWS profile from the shared
+// credentials file and the config file. Static keys are preferred over the
+// credential_process.
+type SharedConfigProvider struct {
+	// Profile is a profile name, AWS_PROFILE environment variable or
+	// "default" is used when empty
+	Profile string
+	// CredentialsFile is a shared credentials file path,
+	// AWS_SHARED_CREDENTIALS_FILE environment variable or
+	// ~/.aws/credentials is used when empty
+	CredentialsFile string
+	// ConfigFile is a config file path, AWS_CONFIG_FILE environment
+	// variable or ~/.aws/config is used when empty
+	ConfigFile string
+}
+
+// Retrieve implements the CredentialProvider interface. An error is returned,
+// when an explicitly requested profile doesn't exist.
+func (p *SharedConfigProvider) Retrieve() (*Credentials, error) {
+	profile := firstNonEmpty(p.Profile, os.Getenv("AWS_PROFILE"))
+	explicit := profile != ""
+	if !explicit {
+		profile = "default"
+	}
+
+	var configFile string
+	credsFile, err := awsFilePath(p.CredentialsFile, "AWS_SHARED_CREDENTIALS_FILE", "credentials")
+	if err == nil {
+		configFile, err = awsFilePath(p.ConfigFile, "AWS_CONFIG_FILE", "config")
+	}
+	if err != nil {
+		// e.g. there is no home directory
+		if !explicit {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// profiles in the config file have a "profile " prefix, except the
+	// default one
+	configSection := "profile " + profile
+	if profile == "default" {
+		configSection = profile
+	}
+
+	found := false
+	for _, f := range []struct {
+		path    string
+		section string
+	}{
+		{credsFile, profile},
+		{configFile, configSection},
+	} {
+		sections, err := readINIFile(f.path)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := sections[f.section]
+		if !ok {
+			continue
+		}
+		found = true
+
+		if s["aws_access_key_id"] != "" {
+			return &Credentials{
+				Access: s["aws_access_key_id"],
+				Secret: s["aws_secret_access_key"],
+				Source: fmt.Sprintf("%q profile in %s", profile, f.path),
+			}, nil
+		}
+
+		if s["credential_process"] != "" {
+			c, err := (&ProcessProvider{Command: s["credential_process"]}).Retrieve()
+			if err != nil {
+				return nil, fmt.Errorf("%q profile in %s: %v", profile, f.path, err)
+			}
+			c.Source = fmt.Sprintf("credential_process of %q profile in %s", profile, f.path)
+			return c, nil
+		}
+	}
+
+	if explicit && !found {
+		return nil, fmt.Errorf("profile %q not found in %s and %s", profile, credsFile, configFile)
+	}
+
+	return nil, nil
+}
+
+func firstNonEmpty(v ...string) string {
+	for _, s := range v {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// awsFilePath returns the path, the environment variable value or the
+// default file path in the ~/.aws directory
+func awsFilePath(path, env, name string) (string, error) {
+	if path = firstNonEmpty(path, os.Getenv(env)); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".aws", name), nil
+}
+
+// readINIFile parses an INI file, a missing file is treated as empty
+func readINIFile(path string) (map[string]map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseINI(string(data)), nil
+}
+
+// ProcessProvider returns credentials printed by an external command in the
+// AWS credential_process JSON format
+type ProcessProvider struct {
+	Command string
+}
+
+// Retrieve implements the CredentialProvider interface
+func (p *ProcessProvider) Retrieve() (*Credentials, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd.exe", "/C", p.Command)
+	} else {
+		cmd = exec.Command("sh", "-c", p.Command)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("credential_process failed: %v", err)
+	}
+
+	var v struct {
+		Version         int
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &v); err != nil {
+		return nil, fmt.Errorf("failed to parse the credential_process output: %v", err)
+	}
+	if v.Version != 1 {
+		return nil, fmt.Errorf("unsupported credential_process output version %d", v.Version)
+	}
+	if v.AccessKeyID == "" || v.SecretAccessKey == "" {
+		return nil, fmt.Errorf("credential_process output doesn't contain AccessKeyId or SecretAccessKey")
+	}
+
+	return &Credentials{
+		Access: v.AccessKeyID,
+		Secret: v.SecretAccessKey,
+		Source: fmt.Sprintf("credential_process %q", p.Command),
+	}, nil
+}
+
+// ChainProvider returns credentials of the first provider, which has them
+type ChainProvider struct {
+	Providers []CredentialProvider
+	// Logger reports the credentials source, when not nil
+	Logger ILogger
+}
+
+// DefaultProviders returns the default credential providers in a resolution
+// order: AWS environment variables, euca2ools environment variables and the
+// AWS profile. An explicit profile is the only provider, so it isn't shadowed
+// by environment variables.
+func DefaultProviders(profile string) []CredentialProvider {
+	if profile != "" {
+		return []CredentialProvider{&SharedConfigProvider{Profile: profile}}
+	}
+	return []CredentialProvider{
+		&EnvProvider{AccessVar: "AWS_ACCESS_KEY_ID", SecretVar: "AWS_SECRET_ACCESS_KEY"},
+		&EnvProvider{AccessVar: "EC2_ACCESS_KEY", SecretVar: "EC2_SECRET_KEY"},
+		&SharedConfigProvider{Profile: profile},
+	}
+}
+
+// Retrieve implements the CredentialProvider interface
+func (p *ChainProvider) Retrieve() (*Credentials, error) {
+	for _, v := range p.Providers {
+		c, err := v.Retrieve()
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			if p.Logger != nil {
+				p.Logger.RequestPrintf("Using EC2 credentials from %s", c.Source)
+			}
+			return c, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,144 @@
+package pkg_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+// setenv sets an environment variable until the test finishes, an empty
+// value unsets the variable
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+
+	old, ok := os.LookupEnv(key)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+}
+
+// writeTempFile writes a file into a temporary directory, which is removed,
+// when the test finishes
+func writeTempFile(t *testing.T, name, data string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "ec2auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefaultProviders(t *testing.T) {
+	credsFile := writeTempFile(t, "credentials", `[default]
+aws_access_key_id = default-access
+aws_secret_access_key = default-secret
+
+[ci]
+aws_access_key_id = ci-access
+aws_secret_access_key = ci-secret
+`)
+	configFile := writeTempFile(t, "config", `[profile process]
+credential_process = printf '{"Version": 1, "AccessKeyId": "process-access", "SecretAccessKey": "process-secret"}'
+`)
+
+	cases := []struct {
+		name    string
+		profile string
+		env     map[string]string
+		access  string
+		secret  string
+		err     string
+	}{
+		{
+			name:   "aws env",
+			env:    map[string]string{"AWS_ACCESS_KEY_ID": "env-access", "AWS_SECRET_ACCESS_KEY": "env-secret", "EC2_ACCESS_KEY": "ec2-access"},
+			access: "env-access",
+			secret: "env-secret",
+		},
+		{
+			name:   "euca2ools env",
+			env:    map[string]string{"EC2_ACCESS_KEY": "ec2-access", "EC2_SECRET_KEY": "ec2-secret"},
+			access: "ec2-access",
+			secret: "ec2-secret",
+		},
+		{
+			name:   "default profile",
+			access: "default-access",
+			secret: "default-secret",
+		},
+		{
+			name:   "AWS_PROFILE",
+			env:    map[string]string{"AWS_PROFILE": "ci"},
+			access: "ci-access",
+			secret: "ci-secret",
+		},
+		{
+			name:    "explicit profile wins over env",
+			profile: "ci",
+			env:     map[string]string{"AWS_ACCESS_KEY_ID": "env-access", "AWS_SECRET_ACCESS_KEY": "env-secret"},
+			access:  "ci-access",
+			secret:  "ci-secret",
+		},
+		{
+			name:    "credential_process",
+			profile: "process",
+			access:  "process-access",
+			secret:  "process-secret",
+		},
+		{
+			name:    "missing explicit profile",
+			profile: "missing",
+			err:     `profile "missing" not found`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.profile == "process" && runtime.GOOS == "windows" {
+				t.Skip("credential_process uses printf")
+			}
+
+			for _, k := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "EC2_ACCESS_KEY", "EC2_SECRET_KEY", "AWS_PROFILE"} {
+				setenv(t, k, c.env[k])
+			}
+			setenv(t, "AWS_SHARED_CREDENTIALS_FILE", credsFile)
+			setenv(t, "AWS_CONFIG_FILE", configFile)
+
+			creds, err := (&pkg.ChainProvider{Providers: pkg.DefaultProviders(c.profile)}).Retrieve()
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected %q error, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds == nil || creds.Access != c.access || creds.Secret != c.secret {
+				t.Errorf("unexpected credentials: %+v", creds)
+			}
+		})
+	}
+}
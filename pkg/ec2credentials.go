@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"github.com/gophercloud/gophercloud"
+)
+
+// EC2Credential represents a Keystone OS-EC2 credential
+type EC2Credential struct {
+	UserID   string `json:"user_id"`
+	TenantID string `json:"tenant_id"`
+	Access   string `json:"access"`
+	Secret   string `json:"secret"`
+	TrustID  string `json:"trust_id,omitempty"`
+}
+
+func ec2CredentialsURL(c *gophercloud.ServiceClient, userID string) string {
+	return c.ServiceURL("users", userID, "credentials", "OS-EC2")
+}
+
+func ec2CredentialURL(c *gophercloud.ServiceClient, userID, access string) string {
+	return c.ServiceURL("users", userID, "credentials", "OS-EC2", access)
+}
+
+// ListEC2Credentials returns EC2 credentials of the user. The identity
+// client must be authenticated, e.g. using WithToken. Request failures are
+// returned as an *AuthError.
+func ListEC2Credentials(identityClient *gophercloud.ServiceClient, userID string) ([]EC2Credential, error) {
+	var body struct {
+		Credentials []EC2Credential `json:"credentials"`
+	}
+	_, err := identityClient.Get(ec2CredentialsURL(identityClient, userID), &body, &gophercloud.RequestOpts{
+		OkCodes: []int{200},
+	})
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+
+	return body.Credentials, nil
+}
+
+// CreateEC2Credential creates a new EC2 credential for the user and the
+// project. The identity client must be authenticated, e.g. using WithToken.
+// Request failures are returned as an *AuthError.
+func CreateEC2Credential(identityClient *gophercloud.ServiceClient, userID, projectID string) (*EC2Credential, error) {
+	req := map[string]string{
+		"tenant_id": projectID,
+	}
+	var body struct {
+		Credential *EC2Credential `json:"credential"`
+	}
+	_, err := identityClient.Post(ec2CredentialsURL(identityClient, userID), req, &body, &gophercloud.RequestOpts{
+		OkCodes: []int{200, 201},
+	})
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+
+	return body.Credential, nil
+}
+
+// GetEC2Credential returns the EC2 credential of the user. The identity
+// client must be authenticated, e.g. using WithToken. Request failures are
+// returned as an *AuthError.
+func GetEC2Credential(identityClient *gophercloud.ServiceClient, userID, access string) (*EC2Credential, error) {
+	var body struct {
+		Credential *EC2Credential `json:"credential"`
+	}
+	_, err := identityClient.Get(ec2CredentialURL(identityClient, userID, access), &body, &gophercloud.RequestOpts{
+		OkCodes: []int{200},
+	})
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+
+	return body.Credential, nil
+}
+
+// DeleteEC2Credential deletes the EC2 credential of the user. The identity
+// client must be authenticated, e.g. using WithToken. Request failures are
+// returned as an *AuthError.
+func DeleteEC2Credential(identityClient *gophercloud.ServiceClient, userID, access string) error {
+	_, err := identityClient.Delete(ec2CredentialURL(identityClient, userID, access), &gophercloud.RequestOpts{
+		OkCodes: []int{204},
+	})
+	return ClassifyError(err)
+}
@@ -0,0 +1,62 @@
+package pkg_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+	"github.com/kayrus/ec2auth/pkg"
+	"github.com/kayrus/ec2auth/pkg/fake"
+)
+
+func TestEC2Credentials(t *testing.T) {
+	client, _ := newFakeKeystone(t, fake.Options{})
+	res := issueToken(t, client)
+	authClient := pkg.WithToken(client, res.TokenID)
+
+	created, err := pkg.CreateEC2Credential(authClient, res.UserID, res.ProjectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Access == "" || created.Secret == "" || created.TenantID != res.ProjectID {
+		t.Fatalf("unexpected credential: %+v", created)
+	}
+
+	// the new credential can be used to authenticate
+	if _, err := pkg.OpenStackEC2Auth(client, &ec2tokens.AuthOptions{Access: created.Access, Secret: created.Secret}); err != nil {
+		t.Fatalf("failed to authenticate using the new credential: %v", err)
+	}
+
+	got, err := pkg.GetEC2Credential(authClient, res.UserID, created.Access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Secret != created.Secret {
+		t.Errorf("unexpected credential: %+v", got)
+	}
+
+	list, err := pkg.ListEC2Credentials(authClient, res.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Errorf("expected 2 credentials, got %d", len(list))
+	}
+
+	if err := pkg.DeleteEC2Credential(authClient, res.UserID, created.Access); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = pkg.GetEC2Credential(authClient, res.UserID, created.Access)
+	var authErr *pkg.AuthError
+	if !errors.As(err, &authErr) || authErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+
+	// credentials of other users are forbidden
+	_, err = pkg.ListEC2Credentials(authClient, "other")
+	if !errors.As(err, &authErr) || authErr.Class != pkg.ErrForbidden {
+		t.Errorf("expected a forbidden error, got %v", err)
+	}
+}
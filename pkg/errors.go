@@ -0,0 +1,227 @@
+package pkg
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// ErrorClass is a class of an authentication failure
+type ErrorClass string
+
+const (
+	// ErrUnauthorized is returned on a signature mismatch or an unknown
+	// access key (HTTP 401)
+	ErrUnauthorized ErrorClass = "unauthorized"
+	// ErrForbidden is returned, when a user or a project is disabled (HTTP
+	// 403)
+	ErrForbidden ErrorClass = "forbidden"
+	// ErrRateLimited is returned on HTTP 429
+	ErrRateLimited ErrorClass = "rate_limited"
+	// ErrServer is returned on HTTP 5xx
+	ErrServer ErrorClass = "server_error"
+	// ErrClient is returned on other HTTP 4xx
+	ErrClient ErrorClass = "client_error"
+	// ErrTLS is returned on TLS handshake and certificate verification
+	// failures
+	ErrTLS ErrorClass = "tls"
+	// ErrDNS is returned, when Keystone hostname cannot be resolved
+	ErrDNS ErrorClass = "dns"
+	// ErrConnectTimeout is returned, when a connection cannot be
+	// established in time
+	ErrConnectTimeout ErrorClass = "connect_timeout"
+	// ErrResponseTimeout is returned, when Keystone doesn't respond in time
+	ErrResponseTimeout ErrorClass = "response_timeout"
+	// ErrConnection is returned on other connection failures, e.g.
+	// connection refused or reset
+	ErrConnection ErrorClass = "connection"
+	// ErrUnknown is returned, when an error cannot be classified
+	ErrUnknown ErrorClass = "unknown"
+)
+
+// AuthError represents a classified authentication error
+type AuthError struct {
+	Class ErrorClass
+	// StatusCode is an HTTP status code, zero when there was no response
+	StatusCode int
+	// Message is a parsed Keystone error message
+	Message string
+	// RequestID is a Keystone request ID
+	RequestID string
+	// Err is the original error
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	var s string
+	if e.StatusCode > 0 {
+		s = fmt.Sprintf("%s: Keystone returned %d %s", e.Class, e.StatusCode, http.StatusText(e.StatusCode))
+		if e.Message != "" {
+			s += ": " + e.Message
+		}
+	} else {
+		s = fmt.Sprintf("%s: %v", e.Class, e.Err)
+	}
+	if e.RequestID != "" {
+		s += fmt.Sprintf(" (request ID: %s)", e.RequestID)
+	}
+	return s
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// Type returns a short error description used to group errors, e.g.
+// "server_error (503)"
+func (e *AuthError) Type() string {
+	if e.StatusCode > 0 {
+		return fmt.Sprintf("%s (%d)", e.Class, e.StatusCode)
+	}
+	return string(e.Class)
+}
+
+// ClassifyError converts an error returned by gophercloud into an AuthError.
+// A nil error is returned as is.
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if e, ok := err.(*AuthError); ok {
+		return e
+	}
+
+	if r, ok := responseError(err); ok {
+		return classifyResponse(err, r)
+	}
+
+	return &AuthError{
+		Class: classifyTransport(err),
+		Err:   err,
+	}
+}
+
+// responseError extracts an unexpected response from gophercloud errors
+func responseError(err error) (*gophercloud.ErrUnexpectedResponseCode, bool) {
+	var r gophercloud.ErrUnexpectedResponseCode
+	switch e := err.(type) {
+	case gophercloud.ErrUnexpectedResponseCode:
+		r = e
+	case gophercloud.ErrDefault400:
+		r = e.ErrUnexpectedResponseCode
+	case gophercloud.ErrDefault401:
+		r = e.ErrUnexpectedResponseCode
+	case gophercloud.ErrDefault403:
+		r = e.ErrUnexpectedResponseCode
+	case gophercloud.ErrDefault404:
+		r = e.ErrUnexpectedResponseCode
+	case gophercloud.ErrDefault405:
+		r = e.ErrUnexpectedResponseCode
+	case gophercloud.ErrDefault408:
+		r = e.ErrUnexpectedResponseCode
+	case gophercloud.ErrDefault409:
+		r = e.ErrUnexpectedResponseCode
+	case gophercloud.ErrDefault429:
+		r = e.ErrUnexpectedResponseCode
+	case gophercloud.ErrDefault500:
+		r = e.ErrUnexpectedResponseCode
+	case gophercloud.ErrDefault503:
+		r = e.ErrUnexpectedResponseCode
+	default:
+		return nil, false
+	}
+	return &r, true
+}
+
+func classifyResponse(err error, r *gophercloud.ErrUnexpectedResponseCode) *AuthError {
+	e := &AuthError{
+		StatusCode: r.Actual,
+		Message:    keystoneErrorMessage(r.Body),
+		Err:        err,
+	}
+	if r.ResponseHeader != nil {
+		e.RequestID = r.ResponseHeader.Get("X-Openstack-Request-Id")
+	}
+
+	switch {
+	case r.Actual == http.StatusUnauthorized:
+		e.Class = ErrUnauthorized
+	case r.Actual == http.StatusForbidden:
+		e.Class = ErrForbidden
+	case r.Actual == http.StatusTooManyRequests:
+		e.Class = ErrRateLimited
+	case r.Actual >= 500:
+		e.Class = ErrServer
+	case r.Actual >= 400:
+		e.Class = ErrClient
+	default:
+		e.Class = ErrUnknown
+	}
+
+	return e
+}
+
+// keystoneErrorMessage parses a Keystone error body:
+// {"error": {"code": 401, "title": "Unauthorized", "message": "..."}}
+func keystoneErrorMessage(body []byte) string {
+	var v struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &v); err == nil && v.Error.Message != "" {
+		return v.Error.Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+func classifyTransport(err error) ErrorClass {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrDNS
+	}
+
+	var recordErr tls.RecordHeaderError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certErr x509.CertificateInvalidError
+	if errors.As(err, &recordErr) || errors.As(err, &unknownAuthErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &certErr) ||
+		strings.Contains(err.Error(), "tls: ") ||
+		strings.Contains(err.Error(), "TLS handshake") ||
+		strings.Contains(err.Error(), "HTTP response to HTTPS client") {
+		return ErrTLS
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		if opErr.Timeout() {
+			return ErrConnectTimeout
+		}
+		return ErrConnection
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if urlErr.Timeout() {
+			return ErrResponseTimeout
+		}
+		return ErrConnection
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrResponseTimeout
+	}
+
+	return ErrUnknown
+}
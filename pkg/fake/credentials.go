@@ -0,0 +1,125 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// ec2Credential is an OS-EC2 credential representation
+type ec2Credential struct {
+	UserID   string  `json:"user_id"`
+	TenantID string  `json:"tenant_id"`
+	Access   string  `json:"access"`
+	Secret   string  `json:"secret"`
+	TrustID  *string `json:"trust_id"`
+}
+
+func newEC2Credential(c Credential) ec2Credential {
+	return ec2Credential{
+		UserID:   c.UserID,
+		TenantID: c.ProjectID,
+		Access:   c.Access,
+		Secret:   c.Secret,
+	}
+}
+
+// handleEC2Credentials handles /v3/users/{user_id}/credentials/OS-EC2
+// requests, users can manage only their own credentials within the token
+// project
+func (s *Server) handleEC2Credentials(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) < 3 || len(parts) > 4 || parts[1] != "credentials" || parts[2] != "OS-EC2" {
+		writeError(w, http.StatusNotFound, "Not Found", "The resource could not be found.")
+		return
+	}
+
+	t := s.lookupToken(r.Header.Get("X-Auth-Token"))
+	if t == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", "The request you have made requires authentication.")
+		return
+	}
+
+	userID := parts[0]
+	if userID != t.cred.UserID {
+		writeError(w, http.StatusForbidden, "Forbidden", "You are not authorized to perform the requested action.")
+		return
+	}
+
+	if len(parts) == 3 {
+		switch r.Method {
+		case http.MethodGet:
+			s.listEC2Credentials(w, userID)
+		case http.MethodPost:
+			s.createEC2Credential(w, r, t)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "The method is not allowed for the requested URL.")
+		}
+		return
+	}
+
+	access := parts[3]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.credentials[access]
+	if !ok || c.UserID != userID {
+		writeError(w, http.StatusNotFound, "Not Found", fmt.Sprintf("Could not find credential: %s.", access))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"credential": newEC2Credential(c)})
+	case http.MethodDelete:
+		delete(s.credentials, access)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "The method is not allowed for the requested URL.")
+	}
+}
+
+func (s *Server) listEC2Credentials(w http.ResponseWriter, userID string) {
+	s.mu.RLock()
+	creds := []ec2Credential{}
+	for _, c := range s.credentials {
+		if c.UserID == userID {
+			creds = append(creds, newEC2Credential(c))
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(creds, func(i, j int) bool {
+		return creds[i].Access < creds[j].Access
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"credentials": creds})
+}
+
+// createEC2Credential creates a credential with the same user and project
+// attributes as the token has
+func (s *Server) createEC2Credential(w http.ResponseWriter, r *http.Request, t *issuedToken) {
+	var body struct {
+		TenantID string `json:"tenant_id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.TenantID == "" {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Invalid JSON in request body.")
+		return
+	}
+
+	if body.TenantID != t.cred.ProjectID {
+		writeError(w, http.StatusForbidden, "Forbidden", "You are not authorized to perform the requested action.")
+		return
+	}
+
+	c := t.cred
+	c.Access = randomHex(16)
+	c.Secret = randomHex(16)
+
+	s.mu.Lock()
+	s.credentials[c.Access] = c
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"credential": newEC2Credential(c)})
+}
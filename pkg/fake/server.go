@@ -0,0 +1,364 @@
+// Package fake implements a fake Keystone server, which supports EC2 and S3
+// token authentication. It is intended for tests and load test rehearsals.
+package fake
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	mrand "math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+// DefaultTokenTTL is a default lifetime of issued tokens
+const DefaultTokenTTL = time.Hour
+
+// DefaultMaxTimeSkew is a default maximum signature V4 timestamp skew, which
+// matches the Keystone auth_ttl option
+const DefaultMaxTimeSkew = 15 * time.Minute
+
+// tokenTimeFormat is a timestamp format used by Keystone
+const tokenTimeFormat = "2006-01-02T15:04:05.000000Z"
+
+// Credential represents an EC2 credential and its owner
+type Credential struct {
+	Access            string        `json:"access"`
+	Secret            string        `json:"secret"`
+	UserID            string        `json:"user_id"`
+	UserName          string        `json:"user_name"`
+	UserDomainID      string        `json:"user_domain_id"`
+	UserDomainName    string        `json:"user_domain_name"`
+	ProjectID         string        `json:"project_id"`
+	ProjectName       string        `json:"project_name"`
+	ProjectDomainID   string        `json:"project_domain_id"`
+	ProjectDomainName string        `json:"project_domain_name"`
+	Roles             []tokens.Role `json:"roles"`
+}
+
+// Config represents the fake server data, which can be loaded from a JSON
+// file
+type Config struct {
+	Credentials []Credential          `json:"credentials"`
+	Catalog     []tokens.CatalogEntry `json:"catalog"`
+}
+
+// LoadConfig reads the fake server data from a JSON file
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Config
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %v", path, err)
+	}
+
+	for i, v := range c.Credentials {
+		if v.Access == "" || v.Secret == "" {
+			return nil, fmt.Errorf("credential %d: access and secret must be set", i)
+		}
+	}
+
+	return &c, nil
+}
+
+// Options represents the fake server behavior
+type Options struct {
+	Config
+	// TokenTTL is a lifetime of issued tokens
+	TokenTTL time.Duration
+	// Latency is added to every response
+	Latency time.Duration
+	// LatencyJitter is a random duration up to this value added to the
+	// Latency
+	LatencyJitter time.Duration
+	// ErrorRate is a fraction of requests, which fail with a 503 error
+	ErrorRate float64
+	// DropRate is a fraction of requests, which connection is closed
+	// without a response
+	DropRate float64
+	// MaxTimeSkew is a maximum difference between a signature V4 timestamp
+	// and the server time, zero disables the check
+	MaxTimeSkew time.Duration
+}
+
+// Server is a fake Keystone server
+type Server struct {
+	opts Options
+
+	// mu protects credentials and tokens
+	mu          sync.RWMutex
+	credentials map[string]Credential
+	tokens      map[string]*issuedToken
+}
+
+type issuedToken struct {
+	cred      Credential
+	issuedAt  time.Time
+	expiresAt time.Time
+	auditID   string
+}
+
+// NewServer returns a fake Keystone server
+func NewServer(opts Options) *Server {
+	if opts.TokenTTL == 0 {
+		opts.TokenTTL = DefaultTokenTTL
+	}
+
+	s := &Server{
+		opts:        opts,
+		credentials: make(map[string]Credential, len(opts.Credentials)),
+		tokens:      make(map[string]*issuedToken),
+	}
+	for _, v := range opts.Credentials {
+		s.credentials[v.Access] = v
+	}
+
+	return s
+}
+
+// ServeHTTP implements the http.Handler interface
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Openstack-Request-Id", "req-"+randomUUID())
+
+	if d := s.latency(); d > 0 {
+		time.Sleep(d)
+	}
+
+	if s.opts.DropRate > 0 && mrand.Float64() < s.opts.DropRate {
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+
+	if s.opts.ErrorRate > 0 && mrand.Float64() < s.opts.ErrorRate {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, "Service Unavailable", "The server is currently unavailable. Please try again at a later time.")
+		return
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == "/v3/ec2tokens":
+		s.handleAuth(w, r, true)
+	case path == "/v3/s3tokens":
+		s.handleAuth(w, r, false)
+	case path == "/v3/auth/tokens":
+		s.handleTokens(w, r)
+	case strings.HasPrefix(path, "/v3/users/"):
+		s.handleEC2Credentials(w, r, strings.Split(strings.TrimPrefix(path, "/v3/users/"), "/"))
+	default:
+		writeError(w, http.StatusNotFound, "Not Found", "The resource could not be found.")
+	}
+}
+
+func (s *Server) latency() time.Duration {
+	d := s.opts.Latency
+	if s.opts.LatencyJitter > 0 {
+		d += time.Duration(mrand.Int63n(int64(s.opts.LatencyJitter)))
+	}
+	return d
+}
+
+// handleAuth handles ec2tokens and s3tokens requests, s3tokens don't issue a
+// token ID
+func (s *Server) handleAuth(w http.ResponseWriter, r *http.Request, ec2 bool) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "The method is not allowed for the requested URL.")
+		return
+	}
+
+	var body struct {
+		Credentials *ec2Credentials `json:"credentials"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.Credentials == nil {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Invalid JSON in request body.")
+		return
+	}
+
+	s.mu.RLock()
+	cred, ok := s.credentials[body.Credentials.Access]
+	s.mu.RUnlock()
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", "The request you have made requires authentication.")
+		return
+	}
+
+	if ec2 {
+		err = body.Credentials.verifyEC2(cred.Secret, s.opts.MaxTimeSkew)
+	} else {
+		err = body.Credentials.verifyS3(cred.Secret)
+	}
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", "The request you have made requires authentication.")
+		return
+	}
+
+	t := &issuedToken{
+		cred:     cred,
+		issuedAt: time.Now().UTC(),
+		auditID:  randomAuditID(),
+	}
+	t.expiresAt = t.issuedAt.Add(s.opts.TokenTTL)
+
+	if ec2 {
+		id := randomToken()
+		s.storeToken(id, t)
+		w.Header().Set("X-Subject-Token", id)
+	}
+
+	writeJSON(w, http.StatusOK, s.tokenBody(t, ec2))
+}
+
+// handleTokens handles token validation and revocation requests, a token
+// must be authenticated by a valid token, e.g. itself
+func (s *Server) handleTokens(w http.ResponseWriter, r *http.Request) {
+	if s.lookupToken(r.Header.Get("X-Auth-Token")) == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", "The request you have made requires authentication.")
+		return
+	}
+
+	id := r.Header.Get("X-Subject-Token")
+	t := s.lookupToken(id)
+	if t == nil {
+		writeError(w, http.StatusNotFound, "Not Found", fmt.Sprintf("Could not find token: %s.", id))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("X-Subject-Token", id)
+		_, noCatalog := r.URL.Query()["nocatalog"]
+		writeJSON(w, http.StatusOK, s.tokenBody(t, !noCatalog))
+	case http.MethodHead:
+		w.Header().Set("X-Subject-Token", id)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.tokens, id)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "The method is not allowed for the requested URL.")
+	}
+}
+
+// lookupToken returns a valid token or nil
+func (s *Server) lookupToken(id string) *issuedToken {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tokens[id]
+	if !ok || time.Now().After(t.expiresAt) {
+		return nil
+	}
+	return t
+}
+
+func (s *Server) storeToken(id string, t *issuedToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// purge expired tokens from time to time
+	if len(s.tokens)%1000 == 999 {
+		now := time.Now()
+		for k, v := range s.tokens {
+			if now.After(v.expiresAt) {
+				delete(s.tokens, k)
+			}
+		}
+	}
+
+	s.tokens[id] = t
+}
+
+func (s *Server) tokenBody(t *issuedToken, withCatalog bool) map[string]interface{} {
+	roles := t.cred.Roles
+	if roles == nil {
+		roles = []tokens.Role{}
+	}
+
+	token := map[string]interface{}{
+		"methods":    []string{"ec2credential"},
+		"audit_ids":  []string{t.auditID},
+		"issued_at":  t.issuedAt.Format(tokenTimeFormat),
+		"expires_at": t.expiresAt.Format(tokenTimeFormat),
+		"is_domain":  false,
+		"roles":      roles,
+		"user": map[string]interface{}{
+			"id":   t.cred.UserID,
+			"name": t.cred.UserName,
+			"domain": map[string]string{
+				"id":   t.cred.UserDomainID,
+				"name": t.cred.UserDomainName,
+			},
+		},
+		"project": map[string]interface{}{
+			"id":   t.cred.ProjectID,
+			"name": t.cred.ProjectName,
+			"domain": map[string]string{
+				"id":   t.cred.ProjectDomainID,
+				"name": t.cred.ProjectDomainName,
+			},
+		},
+	}
+
+	if withCatalog {
+		catalog := s.opts.Catalog
+		if catalog == nil {
+			catalog = []tokens.CatalogEntry{}
+		}
+		token["catalog"] = catalog
+	}
+
+	return map[string]interface{}{"token": token}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a Keystone formatted error
+func writeError(w http.ResponseWriter, code int, title, message string) {
+	writeJSON(w, code, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"title":   title,
+			"message": message,
+		},
+	})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func randomToken() string {
+	return "gAAAAA" + randomHex(64)
+}
+
+func randomAuditID() string {
+	return randomHex(11)
+}
+
+func randomUUID() string {
+	h := randomHex(16)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
@@ -0,0 +1,191 @@
+package fake
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+)
+
+// ec2Credentials represents the "credentials" element of the ec2tokens and
+// s3tokens requests
+type ec2Credentials struct {
+	Access    string            `json:"access"`
+	Signature string            `json:"signature"`
+	Host      string            `json:"host"`
+	Verb      string            `json:"verb"`
+	Path      string            `json:"path"`
+	Params    map[string]string `json:"params"`
+	Headers   map[string]string `json:"headers"`
+	BodyHash  string            `json:"body_hash"`
+	Token     []byte            `json:"token"`
+}
+
+func (c *ec2Credentials) header(name string) string {
+	if v, ok := c.Headers[name]; ok {
+		return v
+	}
+	for k, v := range c.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// verifyEC2 verifies the ec2tokens signature the same way as Keystone does
+// https://github.com/openstack/keystone/blob/stable/train/keystone/api/_shared/EC2_S3_Resource.py
+func (c *ec2Credentials) verifyEC2(secret string, maxSkew time.Duration) error {
+	params := make(map[string]string, len(c.Params))
+	for k, v := range c.Params {
+		if k != "Signature" {
+			params[k] = v
+		}
+	}
+
+	if v, ok := params["SignatureVersion"]; ok {
+		if v != "2" {
+			return fmt.Errorf("unsupported signature version: %s", v)
+		}
+		return c.verifyV2(secret, params)
+	}
+
+	if strings.HasPrefix(c.header("Authorization"), ec2tokens.EC2CredentialsAwsHmacV4) ||
+		params["X-Amz-Algorithm"] == ec2tokens.EC2CredentialsAwsHmacV4 {
+		return c.verifyV4(secret, params, maxSkew)
+	}
+
+	return fmt.Errorf("unknown signature version")
+}
+
+func (c *ec2Credentials) verifyV2(secret string, params map[string]string) error {
+	opts := ec2tokens.AuthOptions{
+		Verb:   c.Verb,
+		Host:   c.Host,
+		Path:   c.Path,
+		Params: params,
+	}
+	stringToSign := ec2tokens.EC2CredentialsBuildStringToSignV2(opts)
+
+	var sig []byte
+	switch params["SignatureMethod"] {
+	case ec2tokens.EC2CredentialsHmacSha256V2:
+		sig = sumHMAC(sha256.New, []byte(secret), stringToSign)
+	case ec2tokens.EC2CredentialsHmacSha1V2:
+		sig = sumHMAC(sha1.New, []byte(secret), stringToSign)
+	default:
+		return fmt.Errorf("unsupported signature method: %s", params["SignatureMethod"])
+	}
+
+	return compareSignatures(c.Signature, base64.StdEncoding.EncodeToString(sig))
+}
+
+func (c *ec2Credentials) verifyV4(secret string, params map[string]string, maxSkew time.Duration) error {
+	var credential, signedHeaders, timestamp string
+	if auth := c.header("Authorization"); auth != "" {
+		credential = authorizationPart(auth, "Credential=")
+		signedHeaders = authorizationPart(auth, "SignedHeaders=")
+		timestamp = c.header("X-Amz-Date")
+	} else {
+		// presigned URL
+		credential = params["X-Amz-Credential"]
+		signedHeaders = params["X-Amz-SignedHeaders"]
+		timestamp = params["X-Amz-Date"]
+		delete(params, "X-Amz-Signature")
+	}
+
+	// access/date/region/service/aws4_request
+	scope := strings.Split(credential, "/")
+	if len(scope) != 5 || scope[4] != ec2tokens.EC2CredentialsAwsRequestV4 {
+		return fmt.Errorf("invalid credential scope: %q", credential)
+	}
+
+	date, err := time.Parse(ec2tokens.EC2CredentialsTimestampFormatV4, timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %q", timestamp)
+	}
+
+	if maxSkew > 0 {
+		if d := time.Since(date); d > maxSkew || d < -maxSkew {
+			return fmt.Errorf("signature expired")
+		}
+	}
+
+	opts := ec2tokens.AuthOptions{
+		Verb:    c.Verb,
+		Path:    c.Path,
+		Params:  params,
+		Headers: c.Headers,
+		Region:  scope[2],
+		Service: scope[3],
+	}
+	stringToSign := ec2tokens.EC2CredentialsBuildStringToSignV4(opts, signedHeaders, c.BodyHash, date)
+	key := ec2tokens.EC2CredentialsBuildSignatureKeyV4(secret, opts.Region, opts.Service, date)
+
+	return compareSignatures(c.Signature, ec2tokens.EC2CredentialsBuildSignatureV4(key, stringToSign))
+}
+
+// verifyS3 verifies the s3tokens signature the same way as Keystone does
+// https://github.com/openstack/keystone/blob/stable/train/keystone/api/s3tokens.py
+func (c *ec2Credentials) verifyS3(secret string) error {
+	stringToSign := c.Token
+	if len(stringToSign) == 0 {
+		return fmt.Errorf("empty token")
+	}
+
+	if !strings.HasPrefix(string(stringToSign), ec2tokens.EC2CredentialsAwsHmacV4) {
+		sig := sumHMAC(sha1.New, []byte(secret), stringToSign)
+		return compareSignatures(c.Signature, base64.StdEncoding.EncodeToString(sig))
+	}
+
+	// AWS4-HMAC-SHA256\ntimestamp\ndate/region/service/aws4_request\nhash
+	lines := strings.Split(string(stringToSign), "\n")
+	if len(lines) != 4 {
+		return fmt.Errorf("invalid string to sign")
+	}
+	scope := strings.Split(lines[2], "/")
+	if len(scope) != 4 {
+		return fmt.Errorf("invalid credential scope: %q", lines[2])
+	}
+	date, err := time.Parse(ec2tokens.EC2CredentialsDateFormatV4, scope[0])
+	if err != nil {
+		return fmt.Errorf("invalid date: %q", scope[0])
+	}
+
+	key := ec2tokens.EC2CredentialsBuildSignatureKeyV4(secret, scope[1], scope[2], date)
+
+	return compareSignatures(c.Signature, ec2tokens.EC2CredentialsBuildSignatureV4(key, stringToSign))
+}
+
+// authorizationPart returns a value of the Authorization header part, e.g.
+// "Credential="
+func authorizationPart(auth, prefix string) string {
+	i := strings.Index(auth, prefix)
+	if i < 0 {
+		return ""
+	}
+	v := auth[i+len(prefix):]
+	if i := strings.Index(v, ","); i >= 0 {
+		v = v[:i]
+	}
+	return strings.TrimSpace(v)
+}
+
+func compareSignatures(got, expected string) error {
+	if !hmac.Equal([]byte(got), []byte(expected)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+func sumHMAC(h func() hash.Hash, key []byte, data []byte) []byte {
+	mac := hmac.New(h, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
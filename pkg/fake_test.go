@@ -0,0 +1,56 @@
+package pkg_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/kayrus/ec2auth/pkg/fake"
+)
+
+const (
+	testAccess = "7522162ced8f4e3eb9502168ef199584"
+	testSecret = "c558d9401a6943bbbb77a83ce910e5a5"
+)
+
+// testCredential is an EC2 credential known by the fake Keystone
+var testCredential = fake.Credential{
+	Access:            testAccess,
+	Secret:            testSecret,
+	UserID:            "u1",
+	UserName:          "alice",
+	UserDomainID:      "default",
+	UserDomainName:    "Default",
+	ProjectID:         "p1",
+	ProjectName:       "demo",
+	ProjectDomainID:   "default",
+	ProjectDomainName: "Default",
+	Roles:             []tokens.Role{{ID: "r1", Name: "member"}},
+}
+
+// newFakeKeystone starts a fake Keystone and returns an identity client
+// connected to it, the server is stopped, when the test finishes
+func newFakeKeystone(t *testing.T, opts fake.Options) (*gophercloud.ServiceClient, *httptest.Server) {
+	t.Helper()
+
+	if opts.Credentials == nil {
+		opts.Credentials = []fake.Credential{testCredential}
+	}
+
+	srv := httptest.NewServer(fake.NewServer(opts))
+	t.Cleanup(srv.Close)
+
+	provider, err := openstack.NewClient(srv.URL + "/v3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := openstack.NewIdentityV3(provider, gophercloud.EndpointOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client, srv
+}
@@ -0,0 +1,32 @@
+package pkg
+
+import (
+	"strings"
+)
+
+// parseINI parses an INI file into sections of key value pairs. Comments
+// starting with "#" or ";" are ignored, keys outside of sections are stored
+// in the "" section.
+func parseINI(data string) map[string]map[string]string {
+	sections := map[string]map[string]string{}
+	section := ""
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		i := strings.IndexAny(line, "=:")
+		if i < 0 {
+			continue
+		}
+		if sections[section] == nil {
+			sections[section] = map[string]string{}
+		}
+		sections[section][strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	return sections
+}
@@ -0,0 +1,37 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseINI(t *testing.T) {
+	data := `
+global = value
+# comment
+[default]
+aws_access_key_id = AK1
+aws_secret_access_key=SK1
+
+; another comment
+[ profile ci ]
+credential_process = printf '{"Version": 1}'
+region: RegionOne
+invalid line
+`
+	expected := map[string]map[string]string{
+		"": {"global": "value"},
+		"default": {
+			"aws_access_key_id":     "AK1",
+			"aws_secret_access_key": "SK1",
+		},
+		"profile ci": {
+			"credential_process": `printf '{"Version": 1}'`,
+			"region":             "RegionOne",
+		},
+	}
+
+	if got := parseINI(data); !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected result: %v", got)
+	}
+}
@@ -0,0 +1,41 @@
+//go:build windows
+// +build windows
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// staleLockTimeout is a time, after which the lock file is considered as
+// abandoned
+const staleLockTimeout = time.Minute
+
+// lockFile acquires an exclusive lock by creating a lock file
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(staleLockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+		if err == nil {
+			f.Close()
+			return func() {
+				os.Remove(path)
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > staleLockTimeout {
+			os.Remove(path)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for the %q lock", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -1,24 +1,65 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
 )
 
+// AuthResult represents the token metadata returned by Keystone on a
+// successful EC2 authentication
 type AuthResult struct {
-	Username string
-	Project  string
-	TokenID  string
+	Username          string                `json:"username"`
+	Project           string                `json:"project"`
+	TokenID           string                `json:"token_id"`
+	UserID            string                `json:"user_id"`
+	UserDomainID      string                `json:"user_domain_id"`
+	UserDomainName    string                `json:"user_domain_name"`
+	ProjectID         string                `json:"project_id"`
+	ProjectDomainID   string                `json:"project_domain_id"`
+	ProjectDomainName string                `json:"project_domain_name"`
+	DomainID          string                `json:"domain_id,omitempty"`
+	DomainName        string                `json:"domain_name,omitempty"`
+	Roles             []tokens.Role         `json:"roles"`
+	Methods           []string              `json:"methods"`
+	AuditIDs          []string              `json:"audit_ids"`
+	IssuedAt          time.Time             `json:"issued_at"`
+	ExpiresAt         time.Time             `json:"expires_at"`
+	Catalog           []tokens.CatalogEntry `json:"catalog"`
 }
 
+// RoleNames returns a list of the token role names
+func (r *AuthResult) RoleNames() []string {
+	names := make([]string, len(r.Roles))
+	for i, v := range r.Roles {
+		names[i] = v.Name
+	}
+	return names
+}
+
+// OpenStackEC2Auth authenticates using EC2 credentials. Request failures are
+// returned as an *AuthError.
 func OpenStackEC2Auth(identityClient *gophercloud.ServiceClient, ao *ec2tokens.AuthOptions) (*AuthResult, error) {
 	res := ec2tokens.Create(identityClient, ao)
 	if res.Err != nil {
-		return nil, res.Err
+		return nil, ClassifyError(res.Err)
 	}
 
+	return NewAuthResult(res)
+}
+
+// OpenStackEC2AuthWithContext is like OpenStackEC2Auth, but the request is
+// canceled, when ctx is done
+func OpenStackEC2AuthWithContext(ctx context.Context, identityClient *gophercloud.ServiceClient, ao *ec2tokens.AuthOptions) (*AuthResult, error) {
+	return OpenStackEC2Auth(WithContext(ctx, identityClient), ao)
+}
+
+// NewAuthResult extracts the token metadata from a Keystone token response
+func NewAuthResult(res tokens.CreateResult) (*AuthResult, error) {
 	user, err := res.ExtractUser()
 	if err != nil {
 		return nil, err
@@ -35,10 +76,59 @@ func OpenStackEC2Auth(identityClient *gophercloud.ServiceClient, ao *ec2tokens.A
 		return nil, fmt.Errorf("empty project scope")
 	}
 
-	tokenID, err := res.ExtractTokenID()
+	token, err := res.ExtractToken()
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := res.ExtractRoles()
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := res.ExtractServiceCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	domain, err := res.ExtractDomain()
+	if err != nil {
+		return nil, err
+	}
+
+	// gophercloud's Token doesn't contain these fields
+	var extra struct {
+		IssuedAt time.Time `json:"issued_at"`
+		Methods  []string  `json:"methods"`
+		AuditIDs []string  `json:"audit_ids"`
+	}
+	err = res.ExtractInto(&extra)
 	if err != nil {
 		return nil, err
 	}
 
-	return &AuthResult{user.Name, project.Name, tokenID}, nil
+	result := &AuthResult{
+		Username:          user.Name,
+		Project:           project.Name,
+		TokenID:           token.ID,
+		UserID:            user.ID,
+		UserDomainID:      user.Domain.ID,
+		UserDomainName:    user.Domain.Name,
+		ProjectID:         project.ID,
+		ProjectDomainID:   project.Domain.ID,
+		ProjectDomainName: project.Domain.Name,
+		Roles:             roles,
+		Methods:           extra.Methods,
+		AuditIDs:          extra.AuditIDs,
+		IssuedAt:          extra.IssuedAt,
+		ExpiresAt:         token.ExpiresAt,
+		Catalog:           catalog.Entries,
+	}
+
+	if domain != nil {
+		result.DomainID = domain.ID
+		result.DomainName = domain.Name
+	}
+
+	return result, nil
 }
@@ -0,0 +1,114 @@
+package pkg_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+	"github.com/kayrus/ec2auth/pkg"
+	"github.com/kayrus/ec2auth/pkg/fake"
+)
+
+func TestOpenStackEC2Auth(t *testing.T) {
+	client, _ := newFakeKeystone(t, fake.Options{})
+
+	v2 := func(method string) ec2tokens.AuthOptions {
+		return ec2tokens.AuthOptions{
+			Access: testAccess,
+			Secret: testSecret,
+			Verb:   "GET",
+			Host:   "ec2.example.com",
+			Path:   "/",
+			Params: map[string]string{
+				"SignatureVersion": "2",
+				"SignatureMethod":  method,
+				"Action":           "DescribeInstances",
+			},
+		}
+	}
+
+	cases := []struct {
+		name string
+		ao   ec2tokens.AuthOptions
+	}{
+		{"v4", ec2tokens.AuthOptions{Access: testAccess, Secret: testSecret}},
+		{"v4 request", ec2tokens.AuthOptions{
+			Access:  testAccess,
+			Secret:  testSecret,
+			Region:  "RegionOne",
+			Service: "s3",
+			Verb:    "PUT",
+			Path:    "/bucket/key",
+			Params:  map[string]string{"acl": ""},
+			Headers: map[string]string{
+				"Host":                "s3.example.com",
+				"X-Amz-SignedHeaders": "host",
+			},
+		}},
+		{"v2 sha256", v2(ec2tokens.EC2CredentialsHmacSha256V2)},
+		{"v2 sha1", v2(ec2tokens.EC2CredentialsHmacSha1V2)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := pkg.OpenStackEC2Auth(client, &c.ao)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.TokenID == "" {
+				t.Errorf("empty token ID")
+			}
+			if res.Username != "alice" || res.ProjectID != "p1" {
+				t.Errorf("unexpected user %q or project %q", res.Username, res.ProjectID)
+			}
+			if got := res.RoleNames(); len(got) != 1 || got[0] != "member" {
+				t.Errorf("unexpected roles: %v", got)
+			}
+			if d := time.Until(res.ExpiresAt); d <= 0 || d > fake.DefaultTokenTTL {
+				t.Errorf("unexpected expiry: %s", res.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestOpenStackEC2AuthErrors(t *testing.T) {
+	client, _ := newFakeKeystone(t, fake.Options{MaxTimeSkew: fake.DefaultMaxTimeSkew})
+
+	stale := time.Now().Add(-time.Hour).UTC()
+	cases := []struct {
+		name string
+		ao   ec2tokens.AuthOptions
+	}{
+		{"wrong secret", ec2tokens.AuthOptions{Access: testAccess, Secret: "wrong"}},
+		{"unknown access", ec2tokens.AuthOptions{Access: "unknown", Secret: testSecret}},
+		{"expired timestamp", ec2tokens.AuthOptions{Access: testAccess, Secret: testSecret, Timestamp: &stale}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := pkg.OpenStackEC2Auth(client, &c.ao)
+			var authErr *pkg.AuthError
+			if !errors.As(err, &authErr) {
+				t.Fatalf("expected an *AuthError, got %v", err)
+			}
+			if authErr.Class != pkg.ErrUnauthorized || authErr.StatusCode != http.StatusUnauthorized {
+				t.Errorf("unexpected error: %v", authErr)
+			}
+			if authErr.RequestID == "" {
+				t.Errorf("empty request ID")
+			}
+		})
+	}
+}
+
+func TestOpenStackEC2AuthServerError(t *testing.T) {
+	client, _ := newFakeKeystone(t, fake.Options{ErrorRate: 1})
+
+	_, err := pkg.OpenStackEC2Auth(client, &ec2tokens.AuthOptions{Access: testAccess, Secret: testSecret})
+	var authErr *pkg.AuthError
+	if !errors.As(err, &authErr) || authErr.Class != pkg.ErrServer || authErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected a server error, got %v", err)
+	}
+}
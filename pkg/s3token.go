@@ -0,0 +1,26 @@
+package pkg
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+)
+
+// ValidateS3Token validates an S3 request signature against the Keystone
+// s3tokens API. The result doesn't contain a token ID, since Keystone doesn't
+// issue a new token.
+func ValidateS3Token(identityClient *gophercloud.ServiceClient, ao *ec2tokens.AuthOptions) (*AuthResult, error) {
+	res := ec2tokens.ValidateS3Token(identityClient, ao)
+	if res.Err != nil {
+		return nil, ClassifyError(res.Err)
+	}
+
+	return NewAuthResult(res)
+}
+
+// ValidateS3TokenWithContext is like ValidateS3Token, but the request is
+// canceled, when ctx is done
+func ValidateS3TokenWithContext(ctx context.Context, identityClient *gophercloud.ServiceClient, ao *ec2tokens.AuthOptions) (*AuthResult, error) {
+	return ValidateS3Token(WithContext(ctx, identityClient), ao)
+}
@@ -0,0 +1,50 @@
+package pkg_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+	"github.com/kayrus/ec2auth/pkg"
+	"github.com/kayrus/ec2auth/pkg/fake"
+)
+
+func TestValidateS3Token(t *testing.T) {
+	client, _ := newFakeKeystone(t, fake.Options{})
+
+	// S3 signature V2 calculated by a client
+	stringToSign := []byte("GET\n\n\nTue, 27 Mar 2007 19:36:42 +0000\n/bucket/key")
+	mac := hmac.New(sha1.New, []byte(testSecret))
+	mac.Write(stringToSign)
+
+	cases := []struct {
+		name string
+		ao   ec2tokens.AuthOptions
+	}{
+		{"v4", ec2tokens.AuthOptions{Access: testAccess, Secret: testSecret, Region: "RegionOne", Service: "s3"}},
+		{"v2", ec2tokens.AuthOptions{Access: testAccess, Token: stringToSign, Signature: mac.Sum(nil)}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := pkg.ValidateS3Token(client, &c.ao)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.TokenID != "" {
+				t.Errorf("s3tokens must not issue a token, got %q", res.TokenID)
+			}
+			if res.Username != "alice" || res.Project != "demo" {
+				t.Errorf("unexpected user %q or project %q", res.Username, res.Project)
+			}
+		})
+	}
+
+	t.Run("mismatch", func(t *testing.T) {
+		ao := ec2tokens.AuthOptions{Access: testAccess, Token: stringToSign, Signature: []byte("wrong")}
+		if _, err := pkg.ValidateS3Token(client, &ao); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
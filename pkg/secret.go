@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// ReadSecret reads a secret from a file, "-" means stdin. Regular files must
+// not be accessible by other users. A trailing newline is trimmed.
+func ReadSecret(path string) (string, error) {
+	if path == "-" {
+		return readSecret(os.Stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fi.Mode().IsRegular() {
+		if err := checkSecretFileMode(fi); err != nil {
+			return "", fmt.Errorf("%q %v", path, err)
+		}
+	}
+
+	return readSecret(f)
+}
+
+// ReadSecretFD reads a secret from an inherited file descriptor, e.g.
+// "ec2auth --secret-fd 3 3<secret". A trailing newline is trimmed.
+func ReadSecretFD(fd uintptr) (string, error) {
+	f := os.NewFile(fd, fmt.Sprintf("fd %d", fd))
+	if f == nil {
+		return "", fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	defer f.Close()
+
+	return readSecret(f)
+}
+
+// PromptSecret reads a secret from the terminal without echoing it
+func PromptSecret(prompt string) (string, error) {
+	return readPassword(prompt)
+}
+
+// readSecret reads a secret and wipes the read buffer, so the secret is kept
+// only in the returned string
+func readSecret(r io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(r)
+	defer wipe(data)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimRight(data, "\r\n")), nil
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
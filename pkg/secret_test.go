@@ -0,0 +1,47 @@
+package pkg_test
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+func TestReadSecret(t *testing.T) {
+	path := writeTempFile(t, "secret", testSecret+"\r\n")
+
+	secret, err := pkg.ReadSecret(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != testSecret {
+		t.Errorf("unexpected secret: %q", secret)
+	}
+
+	if _, err := pkg.ReadSecret(path + ".missing"); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	for _, mode := range []os.FileMode{0640, 0604, 0660} {
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+		_, err := pkg.ReadSecret(path)
+		if err == nil || !strings.Contains(err.Error(), path) {
+			t.Errorf("%o: expected a permission error, got %v", mode, err)
+		}
+	}
+
+	if err := os.Chmod(path, 0400); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pkg.ReadSecret(path); err != nil {
+		t.Errorf("0400: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+// +build !windows
+
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// checkSecretFileMode returns an error, when the file is accessible by group
+// or other users
+func checkSecretFileMode(fi os.FileInfo) error {
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("is accessible by other users (mode %#o), please restrict it to 0600", perm)
+	}
+	return nil
+}
+
+// readPassword reads a line from the terminal with disabled echo
+func readPassword(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to open the terminal: %v", err)
+	}
+	defer tty.Close()
+
+	stty := func(args ...string) error {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = tty
+		return cmd.Run()
+	}
+	if err := stty("-echo"); err != nil {
+		return "", fmt.Errorf("failed to disable the terminal echo: %v", err)
+	}
+	defer func() {
+		stty("echo")
+		fmt.Fprintln(tty)
+	}()
+
+	fmt.Fprint(tty, prompt)
+
+	line, err := bufio.NewReader(tty).ReadSlice('\n')
+	defer wipe(line)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimRight(line, "\r\n")), nil
+}
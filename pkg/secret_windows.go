@@ -0,0 +1,48 @@
+//go:build windows
+// +build windows
+
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+const enableEchoInput = 0x4
+
+var procSetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+// checkSecretFileMode is a noop, since Windows file permissions are not
+// represented by the file mode
+func checkSecretFileMode(fi os.FileInfo) error {
+	return nil
+}
+
+// readPassword reads a line from the console with disabled echo
+func readPassword(prompt string) (string, error) {
+	h := syscall.Handle(os.Stdin.Fd())
+
+	var mode uint32
+	if err := syscall.GetConsoleMode(h, &mode); err != nil {
+		return "", fmt.Errorf("failed to get the console mode: %v", err)
+	}
+	if r, _, err := procSetConsoleMode.Call(uintptr(h), uintptr(mode&^enableEchoInput)); r == 0 {
+		return "", fmt.Errorf("failed to disable the console echo: %v", err)
+	}
+	defer func() {
+		procSetConsoleMode.Call(uintptr(h), uintptr(mode))
+		fmt.Fprintln(os.Stderr)
+	}()
+
+	fmt.Fprint(os.Stderr, prompt)
+
+	line, err := bufio.NewReader(os.Stdin).ReadSlice('\n')
+	defer wipe(line)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimRight(line, "\r\n")), nil
+}
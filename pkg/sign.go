@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+)
+
+// EmptyBodyHash is a SHA-256 hex digest of an empty request body
+var EmptyBodyHash = hex.EncodeToString(sha256.New().Sum(nil))
+
+// SignatureDetails represents intermediate and final values of an EC2
+// signature calculation
+type SignatureDetails struct {
+	Version string `json:"version"`
+	Method  string `json:"method"`
+	// Date is nil for a signature V2, which is not bound to a timestamp
+	Date             *time.Time `json:"date,omitempty"`
+	CanonicalRequest string     `json:"canonical_request,omitempty"`
+	StringToSign     string     `json:"string_to_sign"`
+	Scope            string     `json:"scope,omitempty"`
+	SigningKey       string     `json:"signing_key,omitempty"`
+	BodyHash         string     `json:"body_hash,omitempty"`
+	Signature        string     `json:"signature"`
+	Authorization    string     `json:"authorization,omitempty"`
+}
+
+// SignEC2 calculates an EC2 signature the same way as
+// ec2tokens.AuthOptions does and returns all intermediate values. The
+// ao.Timestamp is set to the current time, when it is nil. The
+// ao.BodyHash defaults to EmptyBodyHash, so the signature is reproducible.
+func SignEC2(ao *ec2tokens.AuthOptions) (*SignatureDetails, error) {
+	if ao.Signature != nil {
+		return nil, fmt.Errorf("signature is already set")
+	}
+
+	opts := *ao
+	if opts.Timestamp == nil {
+		now := time.Now().UTC()
+		opts.Timestamp = &now
+	}
+	if opts.BodyHash == nil {
+		bodyHash := EmptyBodyHash
+		opts.BodyHash = &bodyHash
+	}
+
+	b, err := opts.ToTokenV3CreateMap(nil)
+	if err != nil {
+		return nil, err
+	}
+	c, _ := b["credentials"].(map[string]interface{})
+
+	if v, ok := opts.Params["SignatureVersion"]; ok && v == "2" {
+		sig, _ := c["signature"].([]byte)
+		return &SignatureDetails{
+			Version:      "2",
+			Method:       opts.Params["SignatureMethod"],
+			StringToSign: string(ec2tokens.EC2CredentialsBuildStringToSignV2(opts)),
+			Signature:    base64.StdEncoding.EncodeToString(sig),
+		}, nil
+	}
+
+	date := *opts.Timestamp
+	bodyHash, _ := c["body_hash"].(string)
+	signature, _ := c["signature"].(string)
+	stringToSign, _ := c["token"].([]byte)
+	headers, _ := c["headers"].(map[string]string)
+	signedHeaders := headers["X-Amz-SignedHeaders"]
+
+	return &SignatureDetails{
+		Version:          "4",
+		Method:           ec2tokens.EC2CredentialsAwsHmacV4,
+		Date:             &date,
+		CanonicalRequest: BuildCanonicalRequestV4(opts, signedHeaders, bodyHash),
+		StringToSign:     string(stringToSign),
+		Scope:            BuildScopeV4(opts, date),
+		SigningKey:       hex.EncodeToString(ec2tokens.EC2CredentialsBuildSignatureKeyV4(opts.Secret, opts.Region, opts.Service, date)),
+		BodyHash:         bodyHash,
+		Signature:        signature,
+		Authorization:    headers["Authorization"],
+	}, nil
+}
+
+// BuildCanonicalRequestV4 builds an AWS signature V4 canonical request the
+// same way as ec2tokens.EC2CredentialsBuildStringToSignV4 does
+func BuildCanonicalRequestV4(opts ec2tokens.AuthOptions, signedHeaders string, bodyHash string) string {
+	return strings.Join([]string{
+		opts.Verb,
+		opts.Path,
+		ec2tokens.EC2CredentialsBuildCanonicalQueryStringV4(opts.Verb, opts.Params),
+		ec2tokens.EC2CredentialsBuildCanonicalHeadersV4(opts.Headers, signedHeaders),
+		signedHeaders,
+		bodyHash,
+	}, "\n")
+}
+
+// BuildScopeV4 builds an AWS signature V4 credential scope
+func BuildScopeV4(opts ec2tokens.AuthOptions, date time.Time) string {
+	return strings.Join([]string{
+		date.Format(ec2tokens.EC2CredentialsDateFormatV4),
+		opts.Region,
+		opts.Service,
+		ec2tokens.EC2CredentialsAwsRequestV4,
+	}, "/")
+}
@@ -0,0 +1,123 @@
+package pkg_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+	"github.com/kayrus/ec2auth/pkg"
+)
+
+func TestSignEC2(t *testing.T) {
+	timestamp := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name string
+		ao   ec2tokens.AuthOptions
+	}{
+		{"v4", ec2tokens.AuthOptions{
+			Access:  testAccess,
+			Secret:  testSecret,
+			Region:  "RegionOne",
+			Service: "s3",
+			Verb:    "GET",
+			Path:    "/bucket/key",
+			Params:  map[string]string{"acl": ""},
+			Headers: map[string]string{
+				"Host":                "s3.example.com",
+				"X-Amz-SignedHeaders": "host",
+			},
+		}},
+		{"v2", ec2tokens.AuthOptions{
+			Access: testAccess,
+			Secret: testSecret,
+			Verb:   "GET",
+			Host:   "ec2.example.com",
+			Path:   "/",
+			Params: map[string]string{
+				"SignatureVersion": "2",
+				"SignatureMethod":  ec2tokens.EC2CredentialsHmacSha256V2,
+				"Action":           "DescribeInstances",
+			},
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ao := c.ao
+			ao.Timestamp = &timestamp
+			res, err := pkg.SignEC2(&ao)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// gophercloud calculates the signature sent to Keystone
+			expected := ao
+			bodyHash := pkg.EmptyBodyHash
+			expected.BodyHash = &bodyHash
+			b, err := expected.ToTokenV3CreateMap(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			creds := b["credentials"].(map[string]interface{})
+
+			data, err := json.Marshal(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch c.name {
+			case "v2":
+				sig, _ := creds["signature"].([]byte)
+				if res.Signature != base64.StdEncoding.EncodeToString(sig) {
+					t.Errorf("expected %x signature, got %s", sig, res.Signature)
+				}
+				mac := hmac.New(sha256.New, []byte(testSecret))
+				mac.Write([]byte(res.StringToSign))
+				if res.Signature != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+					t.Errorf("signature doesn't match the string to sign")
+				}
+				if res.Date != nil || strings.Contains(string(data), `"date"`) {
+					t.Errorf("signature V2 must not have a date: %s", data)
+				}
+			case "v4":
+				if res.Signature != creds["signature"] {
+					t.Errorf("expected %v signature, got %s", creds["signature"], res.Signature)
+				}
+				if res.Date == nil || !res.Date.Equal(timestamp) {
+					t.Errorf("unexpected date: %v", res.Date)
+				}
+				if res.BodyHash != pkg.EmptyBodyHash || res.Scope != "20200101/RegionOne/s3/aws4_request" {
+					t.Errorf("unexpected body hash %q or scope %q", res.BodyHash, res.Scope)
+				}
+				// the intermediate values must produce the signature
+				h := sha256.Sum256([]byte(res.CanonicalRequest))
+				if !strings.HasSuffix(res.StringToSign, "\n"+hex.EncodeToString(h[:])) {
+					t.Errorf("string to sign doesn't match the canonical request:\n%s", res.StringToSign)
+				}
+				key, err := hex.DecodeString(res.SigningKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				mac := hmac.New(sha256.New, key)
+				mac.Write([]byte(res.StringToSign))
+				if res.Signature != hex.EncodeToString(mac.Sum(nil)) {
+					t.Errorf("signature doesn't match the signing key and the string to sign")
+				}
+				if !strings.Contains(string(data), `"date":"2020-01-01T00:00:00Z"`) {
+					t.Errorf("unexpected JSON date: %s", data)
+				}
+			}
+		})
+	}
+
+	if _, err := pkg.SignEC2(&ec2tokens.AuthOptions{Signature: "set"}); err == nil {
+		t.Errorf("expected an error for an already set signature")
+	}
+}
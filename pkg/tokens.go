@@ -0,0 +1,53 @@
+package pkg
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+// GetToken validates a token using the Keystone token validation API and
+// returns its metadata. The token authenticates itself, so no other
+// credentials are required. Request failures are returned as an *AuthError.
+func GetToken(identityClient *gophercloud.ServiceClient, token string) (*AuthResult, error) {
+	res := tokens.Get(WithToken(identityClient, token), token)
+	if res.Err != nil {
+		return nil, ClassifyError(res.Err)
+	}
+
+	// CreateResult and GetResult share the same underlying type
+	return NewAuthResult(tokens.CreateResult(res))
+}
+
+// GetTokenWithContext is like GetToken, but the request is canceled, when ctx
+// is done
+func GetTokenWithContext(ctx context.Context, identityClient *gophercloud.ServiceClient, token string) (*AuthResult, error) {
+	return GetToken(WithContext(ctx, identityClient), token)
+}
+
+// RevokeToken revokes a token using the Keystone token revocation API. The
+// token authenticates itself, so no other credentials are required. Request
+// failures are returned as an *AuthError.
+func RevokeToken(identityClient *gophercloud.ServiceClient, token string) error {
+	res := tokens.Revoke(WithToken(identityClient, token), token)
+	return ClassifyError(res.Err)
+}
+
+// RevokeTokenWithContext is like RevokeToken, but the request is canceled,
+// when ctx is done
+func RevokeTokenWithContext(ctx context.Context, identityClient *gophercloud.ServiceClient, token string) error {
+	return RevokeToken(WithContext(ctx, identityClient), token)
+}
+
+// WithToken returns a shallow copy of the service client, which
+// authenticates requests using the token
+func WithToken(client *gophercloud.ServiceClient, token string) *gophercloud.ServiceClient {
+	pc := *client.ProviderClient
+	pc.TokenID = token
+
+	sc := *client
+	sc.ProviderClient = &pc
+
+	return &sc
+}
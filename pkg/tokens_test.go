@@ -0,0 +1,65 @@
+package pkg_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+	"github.com/kayrus/ec2auth/pkg"
+	"github.com/kayrus/ec2auth/pkg/fake"
+)
+
+// issueToken authenticates using the test credential and returns the token
+func issueToken(t *testing.T, client *gophercloud.ServiceClient) *pkg.AuthResult {
+	t.Helper()
+
+	res, err := pkg.OpenStackEC2Auth(client, &ec2tokens.AuthOptions{Access: testAccess, Secret: testSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestGetToken(t *testing.T) {
+	client, _ := newFakeKeystone(t, fake.Options{})
+	res := issueToken(t, client)
+
+	got, err := pkg.GetToken(client, res.TokenID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TokenID != res.TokenID || got.UserID != res.UserID || got.ProjectID != res.ProjectID {
+		t.Errorf("unexpected token: %+v", got)
+	}
+	if !got.ExpiresAt.Equal(res.ExpiresAt) || !got.IssuedAt.Equal(res.IssuedAt) {
+		t.Errorf("unexpected token lifetime: %s - %s", got.IssuedAt, got.ExpiresAt)
+	}
+	if len(got.Methods) != 1 || got.Methods[0] != "ec2credential" {
+		t.Errorf("unexpected methods: %v", got.Methods)
+	}
+
+	_, err = pkg.GetToken(client, "invalid")
+	var authErr *pkg.AuthError
+	if !errors.As(err, &authErr) || authErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected an unauthorized error, got %v", err)
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	client, _ := newFakeKeystone(t, fake.Options{})
+	res := issueToken(t, client)
+
+	if err := pkg.RevokeToken(client, res.TokenID); err != nil {
+		t.Fatal(err)
+	}
+
+	// a revoked token can authenticate neither itself nor a revocation
+	if _, err := pkg.GetToken(client, res.TokenID); err == nil {
+		t.Errorf("revoked token is still valid")
+	}
+	if err := pkg.RevokeToken(client, res.TokenID); err == nil {
+		t.Errorf("revoked token was revoked twice")
+	}
+}
@@ -0,0 +1,227 @@
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a non-empty YAML line without comments
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// parseYAML parses a YAML subset used by clouds.yaml: block mappings, block
+// sequences, quoted and plain scalars, flow sequences of scalars and empty
+// flow collections. Block scalars, anchors, aliases and flow mappings are
+// rejected with an error. Scalars are returned as strings, mappings as
+// map[string]interface{} and sequences as []interface{}.
+func parseYAML(data string) (interface{}, error) {
+	var lines []yamlLine
+	for i, line := range strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n") {
+		line = stripYAMLComment(line)
+		text := strings.TrimLeft(line, " ")
+		if text == "" || text == "---" || text == "..." {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed in indentation", i+1)
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(line) - len(text), text: text})
+	}
+
+	if len(lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	v, next, err := parseYAMLBlock(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[next].num)
+	}
+	return v, nil
+}
+
+// stripYAMLComment removes a comment, which is not a part of a quoted scalar
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t")
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseYAMLBlock parses a block starting at the line i with the indentation
+// and returns the index of the next unparsed line
+func parseYAMLBlock(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	if isYAMLSequenceItem(lines[i].text) {
+		return parseYAMLSequence(lines, i, indent)
+	}
+	return parseYAMLMapping(lines, i, indent)
+}
+
+func parseYAMLSequence(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	seq := []interface{}{}
+	for i < len(lines) && lines[i].indent == indent && isYAMLSequenceItem(lines[i].text) {
+		text := strings.TrimLeft(strings.TrimPrefix(lines[i].text, "-"), " ")
+		if text == "" {
+			if i+1 < len(lines) && lines[i+1].indent > indent {
+				v, next, err := parseYAMLBlock(lines, i+1, lines[i+1].indent)
+				if err != nil {
+					return nil, 0, err
+				}
+				seq = append(seq, v)
+				i = next
+				continue
+			}
+			seq = append(seq, nil)
+			i++
+			continue
+		}
+
+		if _, _, ok := splitYAMLKey(text); ok || isYAMLSequenceItem(text) {
+			// an inline mapping or sequence, e.g. "- key: value"
+			itemIndent := lines[i].indent + len(lines[i].text) - len(text)
+			lines[i] = yamlLine{num: lines[i].num, indent: itemIndent, text: text}
+			v, next, err := parseYAMLBlock(lines, i, itemIndent)
+			if err != nil {
+				return nil, 0, err
+			}
+			seq = append(seq, v)
+			i = next
+			continue
+		}
+
+		v, err := parseYAMLScalar(text, lines[i].num)
+		if err != nil {
+			return nil, 0, err
+		}
+		seq = append(seq, v)
+		i++
+	}
+	return seq, i, nil
+}
+
+func parseYAMLMapping(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	m := map[string]interface{}{}
+	for i < len(lines) && lines[i].indent == indent {
+		if isYAMLSequenceItem(lines[i].text) {
+			return nil, 0, fmt.Errorf("line %d: unexpected sequence item", lines[i].num)
+		}
+		key, value, ok := splitYAMLKey(lines[i].text)
+		if !ok {
+			return nil, 0, fmt.Errorf("line %d: expected a key: value pair", lines[i].num)
+		}
+		key, err := unquoteYAML(key, lines[i].num)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if value != "" {
+			m[key], err = parseYAMLScalar(value, lines[i].num)
+			if err != nil {
+				return nil, 0, err
+			}
+			i++
+			continue
+		}
+
+		// a nested block, sequences are allowed to have the same
+		// indentation as the parent key
+		i++
+		switch {
+		case i < len(lines) && lines[i].indent > indent,
+			i < len(lines) && lines[i].indent == indent && isYAMLSequenceItem(lines[i].text):
+			var v interface{}
+			v, i, err = parseYAMLBlock(lines, i, lines[i].indent)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+		default:
+			m[key] = nil
+		}
+	}
+	if i < len(lines) && lines[i].indent > indent {
+		return nil, 0, fmt.Errorf("line %d: unexpected indentation", lines[i].num)
+	}
+	return m, i, nil
+}
+
+// splitYAMLKey splits a "key: value" line, the value may be empty
+func splitYAMLKey(text string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == ':' && (i == len(text)-1 || text[i+1] == ' '):
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+func unquoteYAML(s string, num int) (string, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("line %d: invalid quoted string: %v", num, err)
+		}
+		return v, nil
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	}
+	return s, nil
+}
+
+func parseYAMLScalar(s string, num int) (interface{}, error) {
+	switch {
+	case s == "{}":
+		return map[string]interface{}{}, nil
+	case s == "[]":
+		return []interface{}{}, nil
+	case s == "~" || s == "null":
+		return nil, nil
+	case strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]"):
+		var seq []interface{}
+		for _, v := range strings.Split(s[1:len(s)-1], ",") {
+			v, err := unquoteYAML(strings.TrimSpace(v), num)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		}
+		return seq, nil
+	case strings.HasPrefix(s, "{"), strings.HasPrefix(s, "|"), strings.HasPrefix(s, ">"),
+		strings.HasPrefix(s, "&"), strings.HasPrefix(s, "*"):
+		return nil, fmt.Errorf("line %d: unsupported YAML syntax: %q", num, s)
+	}
+	return unquoteYAML(s, num)
+}
@@ -0,0 +1,154 @@
+package pkg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	cases := []struct {
+		name     string
+		data     string
+		expected interface{}
+	}{
+		{
+			name:     "empty",
+			data:     "# only a comment\n---\n",
+			expected: map[string]interface{}{},
+		},
+		{
+			name: "comments",
+			data: `# leading comment
+key: value # trailing comment
+hash: "a # b" # the hash is quoted
+url: http://example.com/#anchor
+`,
+			expected: map[string]interface{}{
+				"key":  "value",
+				"hash": "a # b",
+				"url":  "http://example.com/#anchor",
+			},
+		},
+		{
+			name: "scalars",
+			data: `plain: some value
+double: "tab\there \"quoted\""
+single: 'it''s'
+number: 5000
+bool: false
+null: ~
+nothing:
+"quoted key": value
+`,
+			expected: map[string]interface{}{
+				"plain":      "some value",
+				"double":     "tab\there \"quoted\"",
+				"single":     "it's",
+				"number":     "5000",
+				"bool":       "false",
+				"null":       nil,
+				"nothing":    nil,
+				"quoted key": "value",
+			},
+		},
+		{
+			name: "nested maps",
+			data: `clouds:
+  mycloud:
+    auth:
+      auth_url: https://keystone.example.com/v3
+      access: AK1
+    region_name: RegionOne
+  other: {}
+`,
+			expected: map[string]interface{}{
+				"clouds": map[string]interface{}{
+					"mycloud": map[string]interface{}{
+						"auth": map[string]interface{}{
+							"auth_url": "https://keystone.example.com/v3",
+							"access":   "AK1",
+						},
+						"region_name": "RegionOne",
+					},
+					"other": map[string]interface{}{},
+				},
+			},
+		},
+		{
+			name: "sequences",
+			data: `regions:
+- RegionOne
+- RegionTwo
+nested:
+  - name: a
+    value: 1
+  - - x
+    - y
+  -
+empty: []
+`,
+			expected: map[string]interface{}{
+				"regions": []interface{}{"RegionOne", "RegionTwo"},
+				"nested": []interface{}{
+					map[string]interface{}{"name": "a", "value": "1"},
+					[]interface{}{"x", "y"},
+					nil,
+				},
+				"empty": []interface{}{},
+			},
+		},
+		{
+			name: "flow lists",
+			data: `regions: [RegionOne, "Region Two", 'Region ''3''']`,
+			expected: map[string]interface{}{
+				"regions": []interface{}{"RegionOne", "Region Two", "Region '3'"},
+			},
+		},
+		{
+			name:     "windows line endings",
+			data:     "a: b\r\nc: d\r\n",
+			expected: map[string]interface{}{"a": "b", "c": "d"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseYAML(c.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.expected) {
+				t.Errorf("unexpected result:\n%#v\nexpected:\n%#v", got, c.expected)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"tab indentation", "a:\n\tb: c", "tabs are not allowed"},
+		{"literal block", "a: |\n  text", "unsupported YAML syntax"},
+		{"folded block", "a: >\n  text", "unsupported YAML syntax"},
+		{"anchor", "a: &anchor b", "unsupported YAML syntax"},
+		{"alias", "a: *anchor", "unsupported YAML syntax"},
+		{"flow mapping", "a: {b: c}", "unsupported YAML syntax"},
+		{"missing key", "a: b\njust text", "line 2: expected a key: value pair"},
+		{"unexpected indentation", "a: b\n  c: d", "line 2: unexpected indentation"},
+		{"sequence in mapping", "a: b\n- c", "line 2: unexpected sequence item"},
+		{"invalid quoted string", `a: "\q"`, "invalid quoted string"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := parseYAML(c.data)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("expected %q error, got %v", c.err, err)
+			}
+		})
+	}
+}